@@ -0,0 +1,291 @@
+package mrT
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	// backupCurrent is the backup entry name of the current file
+	backupCurrent = "current.tdb"
+	// backupArchive is the backup entry name of the archive file
+	backupArchive = "archive.tdb"
+	// backupManifest is the backup entry name of the manifest
+	backupManifest = "manifest.json"
+)
+
+// manifest describes the contents of a backup
+// Note: The manifest is the last entry of a backup so checksums can be computed while streaming
+type manifest struct {
+	// Backup format version
+	Version int `json:"version"`
+	// Database name
+	Name string `json:"name"`
+	// Backed up files
+	Files []manifestFile `json:"files"`
+	// Creation time (in unix nanoseconds)
+	Created int64 `json:"created"`
+}
+
+// get will return the manifest file with the provided name
+func (m *manifest) get(name string) (mf *manifestFile, ok bool) {
+	for i := range m.Files {
+		if m.Files[i].Name == name {
+			return &m.Files[i], true
+		}
+	}
+
+	return
+}
+
+// manifestFile is a file within a backup
+type manifestFile struct {
+	// Backup entry name
+	Name string `json:"name"`
+	// File size
+	Size int64 `json:"size"`
+	// Hex encoded SHA-256 checksum
+	Checksum string `json:"checksum"`
+}
+
+// snapshot will call fn for the current and archive files while holding both, returning the last snapshot transaction id
+// Note: The current file is held first (matching archive), which blocks transactions and archives until we return
+func (m *MrT) snapshot(fn func(name string, r io.ReadSeeker) error) (lastTxn string, err error) {
+	var cr *fileReader
+	cr, lastTxn = m.lastTxnReader()
+	defer cr.Close()
+	ar := m.archiveReader()
+	defer ar.Close()
+
+	if err = fn(backupCurrent, cr); err != nil {
+		return
+	}
+
+	err = fn(backupArchive, ar)
+	return
+}
+
+// writeBackupFile will write a file to a backup and add it to the manifest
+func writeBackupFile(tw *tar.Writer, mf *manifest, name string, r io.ReadSeeker) (err error) {
+	var size int64
+	if size, err = r.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	if err = writeBackupHeader(tw, name, size); err != nil {
+		return
+	}
+
+	h := sha256.New()
+	if _, err = io.CopyN(io.MultiWriter(tw, h), r, size); err != nil {
+		return
+	}
+
+	mf.Files = append(mf.Files, manifestFile{
+		Name:     name,
+		Size:     size,
+		Checksum: hex.EncodeToString(h.Sum(nil)),
+	})
+
+	return
+}
+
+func writeBackupHeader(tw *tar.Writer, name string, size int64) error {
+	var hdr tar.Header
+	hdr.Name = name
+	hdr.Mode = 0644
+	hdr.Size = size
+	hdr.ModTime = time.Now()
+	return tw.WriteHeader(&hdr)
+}
+
+// copyToFile will copy a reader to a new file at dst, the file is synced before returning
+func copyToFile(fs Storage, dst string, r io.Reader) (err error) {
+	var f File
+	if f, err = createFile(fs, dst); err != nil {
+		return
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(f, r); err != nil {
+		return
+	}
+
+	return f.Sync()
+}
+
+// createFile will open an empty file, any existing contents are truncated
+func createFile(fs Storage, name string) (f File, err error) {
+	if f, err = fs.Open(name); err != nil {
+		return
+	}
+
+	if err = f.Truncate(0); err != nil {
+		f.Close()
+		f = nil
+	}
+
+	return
+}
+
+// getFileSize will return the size of a stored file
+func getFileSize(fs Storage, name string) (size int64, err error) {
+	var f File
+	if f, err = fs.OpenReadOnly(name); err != nil {
+		return
+	}
+	defer f.Close()
+
+	return f.Seek(0, io.SeekEnd)
+}
+
+// getStorage will return the storage of the provided options, the operating system is used when unset
+func getStorage(opts Opts) Storage {
+	if opts.Storage == nil {
+		return NewOSStorage()
+	}
+
+	return opts.Storage
+}
+
+// getPaths will return the current and archive file paths for a database
+func getPaths(dir, name string) (current, archive string) {
+	current = path.Join(dir, name+".tdb")
+	archive = path.Join(dir, "archive", name+".tdb")
+	return
+}
+
+// Restore will verify a backup and materialize it within the provided directory
+// Note: Restoring over an existing database is not allowed, the name must match the backed up database
+func Restore(r io.Reader, dir, name string) (err error) {
+	return RestoreWithOpts(r, dir, name, Opts{})
+}
+
+// RestoreWithOpts will verify a backup and materialize it within the provided directory of the storage set by opts
+// Note: Restoring over an existing database is not allowed, the name must match the backed up database
+func RestoreWithOpts(r io.Reader, dir, name string, opts Opts) (err error) {
+	fs := getStorage(opts)
+	current, archive := getPaths(dir, name)
+	for _, p := range []string{current, archive} {
+		var size int64
+		if size, err = getFileSize(fs, p); err == nil && size > 0 {
+			return ErrRestoreExists
+		} else if err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+
+	if err = fs.MkdirAll(path.Join(dir, "archive")); err != nil {
+		return
+	}
+
+	var (
+		mf *manifest
+		// Restored temporary files by entry name
+		tmps = make(map[string]string)
+		// Computed checksums by entry name
+		checksums = make(map[string]string)
+	)
+
+	defer func() {
+		for _, tmpN := range tmps {
+			fs.Remove(tmpN)
+		}
+	}()
+
+	tr := tar.NewReader(r)
+	for {
+		var hdr *tar.Header
+		if hdr, err = tr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return
+		}
+
+		if hdr.Name == backupManifest {
+			mf = &manifest{}
+			if err = json.NewDecoder(tr).Decode(mf); err != nil {
+				return ErrInvalidBackup
+			}
+
+			continue
+		}
+
+		var target string
+		switch hdr.Name {
+		case backupCurrent:
+			target = current
+		case backupArchive:
+			target = archive
+		default:
+			return ErrInvalidBackup
+		}
+
+		if _, ok := tmps[hdr.Name]; ok {
+			return ErrInvalidBackup
+		}
+
+		tmpN := target + ".restore"
+		var tmpF File
+		if tmpF, err = createFile(fs, tmpN); err != nil {
+			return
+		}
+
+		tmps[hdr.Name] = tmpN
+		h := sha256.New()
+		_, err = io.Copy(io.MultiWriter(tmpF, h), tr)
+		if err == nil {
+			err = tmpF.Sync()
+		}
+
+		tmpF.Close()
+		if err != nil {
+			return
+		}
+
+		checksums[hdr.Name] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	if err = verifyBackup(mf, name, checksums); err != nil {
+		return
+	}
+
+	// Everything checks out, move our files into place
+	if err = fs.Rename(tmps[backupArchive], archive); err != nil {
+		return
+	}
+
+	delete(tmps, backupArchive)
+	if err = fs.Rename(tmps[backupCurrent], current); err != nil {
+		return
+	}
+
+	delete(tmps, backupCurrent)
+	return
+}
+
+// verifyBackup will ensure the restored files match the manifest
+func verifyBackup(mf *manifest, name string, checksums map[string]string) (err error) {
+	if mf == nil || mf.Name != name || len(mf.Files) != len(checksums) {
+		return ErrInvalidBackup
+	}
+
+	for _, entry := range []string{backupCurrent, backupArchive} {
+		f, ok := mf.get(entry)
+		if !ok || checksums[entry] != f.Checksum {
+			return ErrInvalidBackup
+		}
+	}
+
+	return
+}
@@ -0,0 +1,104 @@
+package mrT
+
+import "bytes"
+
+func newBucket(txn *Txn, name string) *Bucket {
+	var b Bucket
+	b.txn = txn
+	b.name = []byte(name)
+	return &b
+}
+
+// Bucket is a transaction scoped to a bucket, buckets are independent keyspaces within a single MrT
+type Bucket struct {
+	txn  *Txn
+	name []byte
+}
+
+// Name will return the bucket name
+func (b *Bucket) Name() string {
+	return string(b.name)
+}
+
+// Put will set a value within the bucket
+func (b *Bucket) Put(key, value []byte) error {
+	if len(b.name) == 0 {
+		return ErrInvalidBucket
+	}
+
+	return b.txn.writeBucketLine(b.txn.buf, BucketPutLine, b.name, key, value)
+}
+
+// Delete will remove a value from the bucket
+func (b *Bucket) Delete(key []byte) error {
+	if len(b.name) == 0 {
+		return ErrInvalidBucket
+	}
+
+	return b.txn.writeBucketLine(b.txn.buf, BucketDeleteLine, b.name, key, nil)
+}
+
+// NewBuckets will return a new buckets filter
+func NewBuckets(names ...string) *Buckets {
+	var b Buckets
+	b.names = make(map[string]struct{}, len(names))
+	for _, name := range names {
+		b.names[name] = struct{}{}
+	}
+
+	return &b
+}
+
+// Buckets is a filter which matches the put and delete lines of the provided buckets
+// Note: Put and delete lines outside of a bucket will not pass, all other line types will pass
+type Buckets struct {
+	names map[string]struct{}
+}
+
+// Filter interface fulfillment
+func (b *Buckets) Filter(buf *bytes.Buffer) (ok bool, err error) {
+	var lineType byte
+	if lineType, err = getLineType(buf); err != nil {
+		return
+	}
+
+	switch lineType {
+	case BucketPutLine, BucketDeleteLine:
+		var bucket []byte
+		if bucket, _, err = getBucket(buf.Bytes()[1:]); err != nil {
+			return
+		}
+
+		_, ok = b.names[string(bucket)]
+	case PutLine, DeleteLine:
+	default:
+		ok = true
+	}
+
+	return
+}
+
+// isActionLine will return whether or not a line type is a put or delete
+func isActionLine(lineType byte) bool {
+	switch lineType {
+	case PutLine, DeleteLine, BucketPutLine, BucketDeleteLine:
+		return true
+	}
+
+	return false
+}
+
+// getBucket will extract the bucket name and the remaining payload of a bucket line
+func getBucket(b []byte) (bucket, payload []byte, err error) {
+	return splitField(b)
+}
+
+// lineBucket will return the bucket name of a line (including it's line type), nil is returned for lines outside of buckets
+func lineBucket(line []byte) (bucket []byte, err error) {
+	if len(line) == 0 || (line[0] != BucketPutLine && line[0] != BucketDeleteLine) {
+		return
+	}
+
+	bucket, _, err = getBucket(line[1:])
+	return
+}
@@ -0,0 +1,318 @@
+package mrT
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/itsmontoya/seeker"
+)
+
+const (
+	// chainManifest is the file name of a backup chain manifest
+	chainManifest = "chain.json"
+)
+
+// ChainEntry is a backup within an incremental backup chain
+type ChainEntry struct {
+	// Position within the chain
+	Seq int `json:"seq"`
+	// Whether or not this is the full base backup
+	Full bool `json:"full"`
+	// Backup file name (relative to the chain directory)
+	File string `json:"file"`
+	// Transaction id the backup starts after, empty for the base backup
+	From string `json:"from,omitempty"`
+	// Last transaction id contained within the backup
+	To string `json:"to"`
+	// Hex encoded SHA-256 checksum of the backup file
+	Checksum string `json:"checksum"`
+	// Creation time (in unix nanoseconds)
+	Created int64 `json:"created"`
+}
+
+// chain is the manifest of an incremental backup chain
+type chain struct {
+	// Backup format version
+	Version int `json:"version"`
+	// Database name
+	Name string `json:"name"`
+	// Chain entries, starting with the base backup
+	Entries []ChainEntry `json:"entries"`
+}
+
+// last will return the last entry of the chain
+func (c *chain) last() (ce ChainEntry, ok bool) {
+	if len(c.Entries) == 0 {
+		return
+	}
+
+	return c.Entries[len(c.Entries)-1], true
+}
+
+// readChain will read the chain manifest within the provided directory
+func readChain(fs Storage, dir string) (c *chain, err error) {
+	var f File
+	if f, err = fs.OpenReadOnly(path.Join(dir, chainManifest)); os.IsNotExist(err) {
+		err = ErrNoBackupChain
+		return
+	} else if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var b []byte
+	if b, err = ioutil.ReadAll(f); err != nil {
+		return
+	}
+
+	c = &chain{}
+	if err = json.Unmarshal(b, c); err != nil {
+		c = nil
+	}
+
+	return
+}
+
+// writeChain will atomically replace the chain manifest within the provided directory
+func writeChain(fs Storage, dir string, c *chain) (err error) {
+	var b []byte
+	if b, err = json.Marshal(c); err != nil {
+		return
+	}
+
+	tmpN := path.Join(dir, chainManifest+".tmp")
+	if err = copyToFile(fs, tmpN, bytes.NewReader(b)); err != nil {
+		return
+	}
+
+	return fs.Rename(tmpN, path.Join(dir, chainManifest))
+}
+
+// writeChainFile will write a chain backup file using fn, returning it's checksum
+// Note: The file is only moved into place once fn has completed successfully
+func writeChainFile(fs Storage, dir, name string, fn func(w io.Writer) error) (checksum string, err error) {
+	tmpN := path.Join(dir, name+".tmp")
+	var tmpF File
+	if tmpF, err = createFile(fs, tmpN); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			fs.Remove(tmpN)
+		}
+	}()
+	defer tmpF.Close()
+
+	h := sha256.New()
+	if err = fn(io.MultiWriter(tmpF, h)); err != nil {
+		return
+	}
+
+	if err = tmpF.Sync(); err != nil {
+		return
+	}
+
+	if err = fs.Rename(tmpN, path.Join(dir, name)); err != nil {
+		return
+	}
+
+	checksum = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+// getChainFileName will return the file name of a chain entry
+func getChainFileName(seq int, full bool) string {
+	if full {
+		return fmt.Sprintf("%06d.full", seq)
+	}
+
+	return fmt.Sprintf("%06d.incr", seq)
+}
+
+// getFileChecksum will return the hex encoded SHA-256 checksum of a file
+func getFileChecksum(fs Storage, filename string) (checksum string, err error) {
+	var f File
+	if f, err = fs.OpenReadOnly(filename); err != nil {
+		return
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return
+	}
+
+	checksum = hex.EncodeToString(h.Sum(nil))
+	return
+}
+
+// VerifyChain will verify the files and continuity of the backup chain within the provided directory
+// Note: The chain is read from the operating system, RestoreChain verifies chains stored elsewhere using it's options
+func VerifyChain(dir string) (entries []ChainEntry, err error) {
+	return verifyChain(NewOSStorage(), dir)
+}
+
+// verifyChain will verify the files and continuity of the backup chain within the provided directory of a storage
+func verifyChain(fs Storage, dir string) (entries []ChainEntry, err error) {
+	var c *chain
+	if c, err = readChain(fs, dir); err != nil {
+		return
+	}
+
+	for i, ce := range c.Entries {
+		if ce.Seq != i || ce.Full != (i == 0) {
+			return nil, ErrBrokenChain
+		}
+
+		if i > 0 && ce.From != c.Entries[i-1].To {
+			// Each incremental must start where the previous backup ended
+			return nil, ErrBrokenChain
+		}
+
+		var checksum string
+		if checksum, err = getFileChecksum(fs, path.Join(dir, ce.File)); os.IsNotExist(err) {
+			return nil, ErrBrokenChain
+		} else if err != nil {
+			return nil, err
+		}
+
+		if checksum != ce.Checksum {
+			return nil, ErrBrokenChain
+		}
+	}
+
+	if len(c.Entries) == 0 {
+		return nil, ErrBrokenChain
+	}
+
+	entries = c.Entries
+	return
+}
+
+// RestoreChain will restore the backup chain within dir to the target directory, replaying incrementals up to
+// and including the provided transaction id. All incrementals are replayed when txnID is empty
+// Note: Options must match the options of the backed up database, the restore point cannot precede the base backup.
+// The chain is read from, and restored to, the storage set by opts
+func RestoreChain(dir, target, name, txnID string, opts Opts) (err error) {
+	fs := getStorage(opts)
+	var entries []ChainEntry
+	if entries, err = verifyChain(fs, dir); err != nil {
+		return
+	}
+
+	var f File
+	if f, err = fs.OpenReadOnly(path.Join(dir, entries[0].File)); err != nil {
+		return
+	}
+
+	err = RestoreWithOpts(f, target, name, opts)
+	f.Close()
+	if err != nil {
+		return
+	}
+
+	if err = replayChain(dir, target, name, txnID, entries, opts); err != nil {
+		// Do not leave a partially restored database behind
+		current, archive := getPaths(target, name)
+		fs.Remove(current)
+		fs.Remove(archive)
+	}
+
+	return
+}
+
+// replayChain will import the incrementals of a chain into a restored base backup
+func replayChain(dir, target, name, txnID string, entries []ChainEntry, opts Opts) (err error) {
+	var m *MrT
+	if m, err = NewWithOpts(target, name, opts); err != nil {
+		return
+	}
+	defer m.Close()
+
+	expected := entries[0].To
+	for _, ce := range entries[1:] {
+		if txnID != "" && txnID == expected {
+			break
+		}
+
+		var lastTxn string
+		if lastTxn, err = m.importChainEntry(path.Join(dir, ce.File), txnID); err != nil {
+			return
+		}
+
+		if lastTxn != ce.To && lastTxn != txnID {
+			// Incremental does not end where our manifest says it does
+			return ErrBrokenChain
+		}
+
+		expected = lastTxn
+	}
+
+	if txnID != "" && txnID != expected {
+		return ErrInvalidTxn
+	}
+
+	var lastTxn string
+	if lastTxn, err = m.LastTxn(); err != nil && err != ErrNoTxn {
+		return
+	}
+
+	if lastTxn != expected {
+		return ErrBrokenChain
+	}
+
+	return nil
+}
+
+// importChainEntry will import an incremental, stopping after txnID when it exists within the incremental
+func (m *MrT) importChainEntry(filename, txnID string) (lastTxn string, err error) {
+	var f File
+	if f, err = m.fs.OpenReadOnly(filename); err != nil {
+		return
+	}
+	defer f.Close()
+
+	return m.importUntil(context.Background(), f, txnID, func(byte, []byte, []byte) error { return nil })
+}
+
+// truncateAfterTxn will truncate an import payload after the provided transaction
+// Note: The payload is left as-is when the transaction does not exist within it
+func truncateAfterTxn(f File, txnID string) (err error) {
+	var (
+		found bool
+		end   int64 = -1
+	)
+
+	if err = forEachLine(f, 0, func(line []byte, offset int64) error {
+		if len(line) == 0 || (line[0] != TransactionLine && line[0] != ReplayLine) {
+			return nil
+		}
+
+		if found {
+			end = offset
+			return seeker.ErrEndEarly
+		}
+
+		found = getKey(line[1:]) == txnID
+		return nil
+	}); err != nil && err != seeker.ErrEndEarly {
+		return
+	}
+
+	if end >= 0 {
+		if err = f.Truncate(end); err != nil {
+			return
+		}
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	return
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/itsmontoya/middleware"
+	"github.com/itsmontoya/mrT"
+)
+
+const usage = `Usage: mrt [options] <command> [command options]
+
+Commands:
+  dump       Print every line in a human readable format
+  txns       Print transactions
+  get-at     Print the value of a key as of a transaction or time
+  stats      Print file statistics
+  verify     Verify the integrity of every line
+  export     Export transactions
+  import     Import an export
+  archive    Archive the current file, populating it with the current state
+  recover    Remove a torn or corrupted tail from the current file
+
+Options:
+`
+
+var (
+	dir             = flag.String("dir", ".", "database directory")
+	name            = flag.String("name", "", "database name")
+	mws             = flag.String("mw", "", "comma separated middlewares in order of application (flate, crypty)")
+	cryptyKey       = flag.String("key", "", "crypty middleware encryption key")
+	cryptyIV        = flag.String("iv", "", "crypty middleware initialization vector (defaults to 16 zero bytes)")
+	flateLevel      = flag.Int("flate-level", 9, "flate middleware compression level")
+	flateDict       = flag.String("flate-dict", "", "flate middleware dictionary file (optional, defaults to the stored dictionary)")
+	compressArchive = flag.Bool("compress-archive", false, "compress archived lines into segments")
+	objects         = flag.String("objects", "", "directory archived segments are tiered to (optional, implies -compress-archive)")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+	if flag.NArg() == 0 || *name == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	m, err := open(!writers[flag.Arg(0)])
+	if err != nil {
+		fail(err)
+	}
+
+	err = cmd(m, flag.Args()[1:])
+	if cerr := m.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		fail(err)
+	}
+}
+
+// command is a sub command, args are the arguments following the command name
+type command func(m *mrT.MrT, args []string) error
+
+var commands = map[string]command{
+	"dump":    runDump,
+	"txns":    runTxns,
+	"get-at":  runGetAt,
+	"stats":   runStats,
+	"verify":  runVerify,
+	"export":  runExport,
+	"import":  runImport,
+	"archive": runArchive,
+	"recover": runRecover,
+}
+
+// writers are the commands which write to the database, all other commands open it read-only
+var writers = map[string]bool{
+	"import":  true,
+	"archive": true,
+	"recover": true,
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	os.Exit(1)
+}
+
+func open(readOnly bool) (m *mrT.MrT, err error) {
+	var opts mrT.Opts
+	opts.ReadOnly = readOnly
+	if opts.Middlewares, err = getMiddlewares(); err != nil {
+		return
+	}
+
+	opts.CompressArchive = *compressArchive
+	if *objects != "" {
+		opts.ObjectStore = mrT.NewDirStore(*objects)
+	}
+
+	return mrT.NewWithOpts(*dir, *name, opts)
+}
+
+func getMiddlewares() (mwList []middleware.Middleware, err error) {
+	if *mws == "" {
+		return
+	}
+
+	for _, mwName := range strings.Split(*mws, ",") {
+		switch strings.TrimSpace(mwName) {
+		case "flate":
+			var dict []byte
+			if *flateDict != "" {
+				if dict, err = ioutil.ReadFile(*flateDict); err != nil {
+					return
+				}
+			}
+
+			mwList = append(mwList, mrT.NewFlateMW(*flateLevel, dict))
+
+		case "crypty":
+			if *cryptyKey == "" {
+				return nil, fmt.Errorf("crypty middleware requires a key")
+			}
+
+			iv := []byte(*cryptyIV)
+			if len(iv) == 0 {
+				iv = make([]byte, 16)
+			}
+
+			mwList = append(mwList, middleware.NewCryptyMW([]byte(*cryptyKey), iv))
+
+		default:
+			return nil, fmt.Errorf("unknown middleware: %s", mwName)
+		}
+	}
+
+	return
+}
+
+func getLineTypeName(lineType byte) string {
+	switch lineType {
+	case mrT.TransactionLine:
+		return "TXN"
+	case mrT.ReplayLine:
+		return "REPLAY"
+	case mrT.CommentLine:
+		return "COMMENT"
+	case mrT.PutLine:
+		return "PUT"
+	case mrT.DeleteLine:
+		return "DELETE"
+	case mrT.BucketPutLine:
+		return "BUCKET_PUT"
+	case mrT.BucketDeleteLine:
+		return "BUCKET_DELETE"
+	case mrT.HeaderLine:
+		return "HEADER"
+	case mrT.SegmentLine:
+		return "SEGMENT"
+	case mrT.TieredLine:
+		return "TIERED"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", lineType)
+	}
+}
+
+func formatTxn(txnID string) string {
+	ts, err := mrT.TxnTime(txnID)
+	if err != nil {
+		return txnID
+	}
+
+	return fmt.Sprintf("%s (%s)", txnID, ts.Format(time.RFC3339Nano))
+}
+
+func parseTime(value string) (ts time.Time, err error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func runDump(m *mrT.MrT, args []string) (err error) {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	archive := fs.Bool("archive", true, "include the archive")
+	fs.Parse(args)
+
+	return m.ForEachLine(*archive, func(lineType byte, key, value []byte) (err error) {
+		switch lineType {
+		case mrT.TransactionLine, mrT.ReplayLine:
+			_, err = fmt.Printf("%-13s %s\n", getLineTypeName(lineType), formatTxn(string(key)))
+		case mrT.CommentLine:
+			_, err = fmt.Printf("%-13s %s\n", getLineTypeName(lineType), key)
+		case mrT.HeaderLine:
+			_, err = fmt.Printf("%-13s %s\n", getLineTypeName(lineType), value)
+		default:
+			_, err = fmt.Printf("%-13s %q = %q\n", getLineTypeName(lineType), key, value)
+		}
+
+		return
+	})
+}
+
+func runTxns(m *mrT.MrT, args []string) (err error) {
+	fs := flag.NewFlagSet("txns", flag.ExitOnError)
+	from := fs.String("from", "", "start time (RFC3339)")
+	to := fs.String("to", "", "end time (RFC3339)")
+	verbose := fs.Bool("v", false, "print transaction actions")
+	fs.Parse(args)
+
+	start := time.Unix(0, 0)
+	end := time.Now()
+	if *from != "" {
+		if start, err = parseTime(*from); err != nil {
+			return
+		}
+	}
+
+	if *to != "" {
+		if end, err = parseTime(*to); err != nil {
+			return
+		}
+	}
+
+	return m.ForEachTxnBetween(start, end, func(ti *mrT.TxnInfo) (err error) {
+		if _, err = fmt.Printf("%s, %d actions\n", formatTxn(ti.ID), len(ti.Actions)); err != nil || !*verbose {
+			return
+		}
+
+		for _, ai := range ti.Actions {
+			action := "DELETE"
+			if ai.Put {
+				action = "PUT"
+			}
+
+			if ai.Bucket != "" {
+				action += " [" + ai.Bucket + "]"
+			}
+
+			if _, err = fmt.Printf("\t%s %q = %q\n", action, ai.Key, ai.Value); err != nil {
+				return
+			}
+		}
+
+		return
+	})
+}
+
+func runGetAt(m *mrT.MrT, args []string) (err error) {
+	fs := flag.NewFlagSet("get-at", flag.ExitOnError)
+	txnID := fs.String("txn", "", "transaction id (defaults to the last transaction)")
+	at := fs.String("time", "", "point in time (RFC3339)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("get-at requires a key")
+	}
+
+	var value []byte
+	key := []byte(fs.Arg(0))
+	switch {
+	case *at != "":
+		var ts time.Time
+		if ts, err = parseTime(*at); err != nil {
+			return
+		}
+
+		value, err = m.GetAtTime(key, ts)
+
+	case *txnID != "":
+		value, err = m.GetAt(key, *txnID)
+
+	default:
+		var lastTxn string
+		if lastTxn, err = m.LastTxn(); err != nil {
+			return
+		}
+
+		value, err = m.GetAt(key, lastTxn)
+	}
+
+	if err != nil {
+		return
+	}
+
+	_, err = fmt.Printf("%s\n", value)
+	return
+}
+
+func runStats(m *mrT.MrT, args []string) (err error) {
+	counts := make(map[string]int)
+	if err = m.ForEachLine(true, func(lineType byte, key, value []byte) (err error) {
+		counts[getLineTypeName(lineType)]++
+		return
+	}); err != nil {
+		return
+	}
+
+	var stats mrT.Stats
+	if stats, err = m.Stats(); err != nil {
+		return
+	}
+
+	hdr := m.Header()
+	fmt.Printf("name:         %s\n", hdr.Name)
+	fmt.Printf("version:      %d\n", hdr.Version)
+	fmt.Printf("middlewares:  %s\n", strings.Join(hdr.Middlewares, ","))
+	fmt.Printf("created:      %s\n", hdr.CreatedAt().Format(time.RFC3339))
+	fmt.Printf("current size: %d bytes (%d txns, %d actions)\n", stats.CurrentSize, stats.CurrentTxns, stats.CurrentActions)
+	fmt.Printf("archive size: %d bytes (%d txns, %d actions)\n", stats.ArchiveSize, stats.ArchiveTxns, stats.ArchiveActions)
+	fmt.Printf("live keys:    %d (%.1f%% live, %d dead records)\n", stats.Keys, stats.LiveRatio()*100, stats.DeadRecords)
+
+	if !stats.Oldest.IsZero() {
+		fmt.Printf("oldest txn:   %s\n", stats.Oldest.Format(time.RFC3339Nano))
+		fmt.Printf("newest txn:   %s\n", stats.Newest.Format(time.RFC3339Nano))
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%-13s %d\n", strings.ToLower(name)+":", counts[name])
+	}
+
+	return
+}
+
+func runVerify(m *mrT.MrT, args []string) (err error) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var opts mrT.VerifyOpts
+	fs.BoolVar(&opts.SkipArchive, "skip-archive", false, "only verify the current file")
+	fs.BoolVar(&opts.SkipDecode, "skip-decode", false, "skip decoding puts and deletes through their middlewares")
+	fs.IntVar(&opts.MaxProblems, "max", 0, "maximum number of problems to report (zero is unlimited)")
+	fs.Parse(args)
+
+	var report mrT.VerifyReport
+	if report, err = m.Verify(opts); err != nil {
+		return
+	}
+
+	for _, w := range report.Warnings {
+		fmt.Println("warning:", w)
+	}
+
+	for _, p := range report.Problems {
+		fmt.Println(p)
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("verification failed, %d problems found", len(report.Problems))
+	}
+
+	_, err = fmt.Printf("OK, %d lines and %d transactions verified\n", report.Lines, report.Transactions)
+	return
+}
+
+func runExport(m *mrT.MrT, args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	txnID := fs.String("txn", "", "export transactions following this transaction id")
+	out := fs.String("o", "", "output file (defaults to stdout)")
+	fs.Parse(args)
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		var f *os.File
+		if f, err = os.Create(*out); err != nil {
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return m.Export(*txnID, w)
+}
+
+func runImport(m *mrT.MrT, args []string) (err error) {
+	var r io.Reader = os.Stdin
+	if len(args) > 0 {
+		var f *os.File
+		if f, err = os.Open(args[0]); err != nil {
+			return
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var lastTxn string
+	if lastTxn, err = m.Import(r, func(byte, []byte, []byte) error { return nil }); err != nil {
+		return
+	}
+
+	_, err = fmt.Printf("imported through %s\n", formatTxn(lastTxn))
+	return
+}
+
+// bucketKey is a key within an (optional) bucket
+type bucketKey struct {
+	bucket string
+	key    string
+}
+
+func runArchive(m *mrT.MrT, args []string) (err error) {
+	// Build the current state, the current file begins with the replay block of the last archive
+	state := make(map[bucketKey]string)
+	if err = m.ForEachTxn("", false, func(ti *mrT.TxnInfo) (err error) {
+		for _, ai := range ti.Actions {
+			bk := bucketKey{ai.Bucket, ai.Key}
+			if ai.Put {
+				state[bk] = ai.Value
+			} else {
+				delete(state, bk)
+			}
+		}
+
+		return
+	}); err != nil && err != mrT.ErrNoTxn {
+		return
+	}
+
+	if err = m.Archive(func(txn *mrT.Txn) (err error) {
+		for bk, value := range state {
+			if bk.bucket == "" {
+				err = txn.Put([]byte(bk.key), []byte(value))
+			} else {
+				err = txn.Bucket(bk.bucket).Put([]byte(bk.key), []byte(value))
+			}
+
+			if err != nil {
+				return
+			}
+		}
+
+		return
+	}); err != nil {
+		return
+	}
+
+	_, err = fmt.Printf("archived, %d keys carried forward\n", len(state))
+	return
+}
+
+func runRecover(m *mrT.MrT, args []string) (err error) {
+	var removed int64
+	if removed, err = m.Recover(); err != nil {
+		return
+	}
+
+	_, err = fmt.Printf("removed %d bytes\n", removed)
+	return
+}
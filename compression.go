@@ -0,0 +1,454 @@
+package mrT
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/itsmontoya/middleware"
+	"github.com/itsmontoya/seeker"
+)
+
+const (
+	// escapeByte prefixes escaped bytes within compressed output
+	escapeByte = 0xFF
+	// escapedEscape is the escaped representation of the escape byte
+	escapedEscape = 0x00
+	// escapedNewline is the escaped representation of a newline
+	escapedNewline = 0x01
+
+	// dictionaryShingle is the length of the substrings considered when training a dictionary
+	dictionaryShingle = 8
+)
+
+// NewFlateMW will return a new flate compression middleware
+// Note: Dictionary is optional, when provided it will be stored within the file header. Small records
+// compress poorly at the faster levels, flate.BestCompression is recommended when using a dictionary
+func NewFlateMW(level int, dictionary []byte) *FlateMW {
+	var f FlateMW
+	f.level = level
+	f.dict = dictionary
+	return &f
+}
+
+// FlateMW is a compression middleware which supports shared dictionaries
+// Note: Compressed output is escaped so it never contains a newline
+type FlateMW struct {
+	mux   sync.RWMutex
+	level int
+	dict  []byte
+}
+
+// Name will return the middleware name
+func (f *FlateMW) Name() string {
+	return "flate"
+}
+
+// Writer will return a new compressing writer
+func (f *FlateMW) Writer(w io.Writer) (wc io.WriteCloser, err error) {
+	return newCompressor(w, f.level, f.dictionary())
+}
+
+// Reader will return a new decompressing reader
+func (f *FlateMW) Reader(r io.Reader) (rc io.ReadCloser, err error) {
+	return newDecompressor(r, f.dictionary()), nil
+}
+
+func (f *FlateMW) dictionary() (dict []byte) {
+	f.mux.RLock()
+	dict = f.dict
+	f.mux.RUnlock()
+	return
+}
+
+func (f *FlateMW) setDictionary(dict []byte) {
+	f.mux.Lock()
+	f.dict = dict
+	f.mux.Unlock()
+}
+
+// dictionaryMW is implemented by middlewares which use a shared dictionary
+type dictionaryMW interface {
+	dictionary() []byte
+	setDictionary(dict []byte)
+}
+
+func newCompressor(w io.Writer, level int, dict []byte) (c *compressor, err error) {
+	var cc compressor
+	cc.e = newEscaper(w)
+	if cc.fw, err = flate.NewWriterDict(cc.e, level, dict); err != nil {
+		return
+	}
+
+	c = &cc
+	return
+}
+
+// compressor is a flate writer which escapes it's output
+type compressor struct {
+	e  *escaper
+	fw *flate.Writer
+}
+
+func (c *compressor) Write(b []byte) (n int, err error) {
+	return c.fw.Write(b)
+}
+
+func (c *compressor) Close() (err error) {
+	return c.fw.Close()
+}
+
+func newDecompressor(r io.Reader, dict []byte) *decompressor {
+	var d decompressor
+	d.fr = flate.NewReaderDict(newUnescaper(r), dict)
+	return &d
+}
+
+// decompressor is a flate reader which unescapes it's input
+type decompressor struct {
+	fr io.ReadCloser
+}
+
+func (d *decompressor) Read(b []byte) (n int, err error) {
+	return d.fr.Read(b)
+}
+
+func (d *decompressor) Close() (err error) {
+	return d.fr.Close()
+}
+
+func newEscaper(w io.Writer) *escaper {
+	var e escaper
+	e.w = w
+	return &e
+}
+
+// escaper replaces newlines and escape bytes so the output can safely live within a line
+type escaper struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (e *escaper) Write(b []byte) (n int, err error) {
+	e.buf = e.buf[:0]
+	for _, c := range b {
+		switch c {
+		case escapeByte:
+			e.buf = append(e.buf, escapeByte, escapedEscape)
+		case '\n':
+			e.buf = append(e.buf, escapeByte, escapedNewline)
+		default:
+			e.buf = append(e.buf, c)
+		}
+	}
+
+	if _, err = e.w.Write(e.buf); err != nil {
+		return
+	}
+
+	return len(b), nil
+}
+
+func newUnescaper(r io.Reader) *unescaper {
+	var u unescaper
+	u.r = bufio.NewReader(r)
+	return &u
+}
+
+// unescaper reverses the output of an escaper
+type unescaper struct {
+	r *bufio.Reader
+}
+
+func (u *unescaper) Read(b []byte) (n int, err error) {
+	for n < len(b) {
+		var c byte
+		if c, err = u.r.ReadByte(); err != nil {
+			break
+		}
+
+		if c == escapeByte {
+			if c, err = u.r.ReadByte(); err != nil {
+				err = io.ErrUnexpectedEOF
+				break
+			}
+
+			switch c {
+			case escapedEscape:
+				c = escapeByte
+			case escapedNewline:
+				c = '\n'
+			default:
+				err = ErrInvalidLine
+				return
+			}
+		}
+
+		b[n] = c
+		n++
+	}
+
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+
+	return
+}
+
+// TrainDictionary will build a shared compression dictionary (of up to size bytes) from sample values
+// Note: Samples are chosen by how common their substrings are, the most representative samples are
+// placed at the end of the dictionary where they are cheapest to reference
+func TrainDictionary(samples [][]byte, size int) (dict []byte) {
+	counts := make(map[string]int)
+	for _, sample := range samples {
+		for shingle := range getShingles(sample) {
+			counts[shingle]++
+		}
+	}
+
+	scored := make([]scoredSample, 0, len(samples))
+	for _, sample := range samples {
+		var ss scoredSample
+		ss.sample = sample
+		ss.shingles = getShingles(sample)
+		for shingle := range ss.shingles {
+			if count := counts[shingle]; count > 1 {
+				// Substrings which only occur once are not worth storing
+				ss.score += count
+			}
+		}
+
+		scored = append(scored, ss)
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+
+	covered := make(map[string]struct{})
+	for _, ss := range scored {
+		if len(dict)+len(ss.sample) > size {
+			continue
+		}
+
+		if !ss.addsCoverage(covered) {
+			// Everything this sample offers is already within our dictionary
+			continue
+		}
+
+		dict = append(append([]byte{}, ss.sample...), dict...)
+	}
+
+	return
+}
+
+// scoredSample is a dictionary training sample
+type scoredSample struct {
+	sample   []byte
+	shingles map[string]struct{}
+	score    int
+}
+
+// addsCoverage will add the sample's substrings to covered, returning whether or not any were new
+func (s *scoredSample) addsCoverage(covered map[string]struct{}) (added bool) {
+	for shingle := range s.shingles {
+		if _, ok := covered[shingle]; ok {
+			continue
+		}
+
+		covered[shingle] = struct{}{}
+		added = true
+	}
+
+	return
+}
+
+// getShingles will return the unique fixed length substrings of a sample
+func getShingles(sample []byte) (shingles map[string]struct{}) {
+	shingles = make(map[string]struct{})
+	for i := 0; i+dictionaryShingle <= len(sample); i++ {
+		shingles[string(sample[i:i+dictionaryShingle])] = struct{}{}
+	}
+
+	return
+}
+
+// writeSegment will write a compressed segment line containing the provided lines
+func (m *MrT) writeSegment(w io.Writer, lines []byte) (err error) {
+	var segment []byte
+	if segment, err = m.compressSegment(lines); err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(SegmentLine)
+	buf.Write(segment)
+	buf.WriteByte('\n')
+	_, err = w.Write(buf.Bytes())
+	return
+}
+
+// sealSegment will write the provided lines as a segment line, or a tiered line when an object store is set
+func (m *MrT) sealSegment(w io.Writer, lines []byte) (err error) {
+	if m.tier != nil {
+		return m.tierSegment(w, lines)
+	}
+
+	return m.writeSegment(w, lines)
+}
+
+// compressSegment will compress lines into the payload of a segment
+func (m *MrT) compressSegment(lines []byte) (segment []byte, err error) {
+	var buf bytes.Buffer
+	var c *compressor
+	if c, err = newCompressor(&buf, flate.DefaultCompression, m.hdr.Dictionary); err != nil {
+		return
+	}
+
+	if _, err = c.Write(lines); err != nil {
+		return
+	}
+
+	if err = c.Close(); err != nil {
+		return
+	}
+
+	segment = buf.Bytes()
+	return
+}
+
+// readSegment will return the lines contained within a segment line (without it's line type)
+func (m *MrT) readSegment(b []byte) (lines []byte, err error) {
+	d := newDecompressor(bytes.NewReader(b), m.hdr.Dictionary)
+	defer d.Close()
+	return ioutil.ReadAll(d)
+}
+
+// readSegmentLine will return the lines contained within a segment or tiered line, tiered segments are fetched
+// from our object store
+func (m *MrT) readSegmentLine(line []byte) (lines []byte, err error) {
+	if len(line) == 0 || !isSegmentLine(line[0]) {
+		return nil, ErrInvalidLine
+	}
+
+	if line[0] == SegmentLine {
+		return m.readSegment(line[1:])
+	}
+
+	var segment []byte
+	if segment, err = m.fetchSegment(line[1:]); err != nil {
+		return
+	}
+
+	return m.readSegment(segment)
+}
+
+// isSegmentLine will return whether or not a line type contains a block of archived lines
+func isSegmentLine(lineType byte) bool {
+	return lineType == SegmentLine || lineType == TieredLine
+}
+
+// expandSegments will wrap a line func so the lines within segments are passed individually
+func (m *MrT) expandSegments(fn func(*bytes.Buffer) error) func(*bytes.Buffer) error {
+	return func(buf *bytes.Buffer) (err error) {
+		if lineType, _ := getLineType(buf); !isSegmentLine(lineType) {
+			return fn(buf)
+		}
+
+		var lines []byte
+		if lines, err = m.readSegmentLine(buf.Bytes()); err != nil {
+			return
+		}
+
+		s := seeker.New(bytes.NewReader(lines))
+		var ended bool
+		if err = s.ReadLines(func(buf *bytes.Buffer) (err error) {
+			if err = fn(buf); err == seeker.ErrEndEarly {
+				ended = true
+			}
+
+			return
+		}); err != nil {
+			return
+		}
+
+		if ended {
+			// Our func ended early within the segment, pass it on to the outer reader
+			return seeker.ErrEndEarly
+		}
+
+		return
+	}
+}
+
+// getDictionary will return the dictionary of the first middleware which has one
+func getDictionary(mws []middleware.Middleware) (dict []byte) {
+	for _, mw := range mws {
+		dmw, ok := mw.(dictionaryMW)
+		if !ok {
+			continue
+		}
+
+		if dict = dmw.dictionary(); dict != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// setDictionary will set the stored dictionary for our header and any dictionary middlewares which lack one
+func (m *MrT) setDictionary(dict []byte) {
+	if dict == nil || m.hdr.Dictionary != nil {
+		return
+	}
+
+	m.hdr.Dictionary = dict
+	for _, mw := range m.mws {
+		if dmw, ok := mw.(dictionaryMW); ok && dmw.dictionary() == nil {
+			dmw.setDictionary(dict)
+		}
+	}
+}
+
+// readSegmentLineAt will read a line from within the segment located at the provided offset
+func (m *MrT) readSegmentLineAt(r io.ReadSeeker, offset, inner int64) (buf *bytes.Buffer, err error) {
+	if buf, err = readLineAt(r, offset); err != nil {
+		return
+	}
+
+	var lines []byte
+	if lines, err = m.readSegmentLine(buf.Bytes()); err != nil {
+		return
+	}
+
+	return readLineAt(bytes.NewReader(lines), inner)
+}
+
+// rekeySegment will write a segment or tiered line (without it's trailing newline) to the buffer, re-encoding it's
+// lines with the active key when needed
+// Note: Re-encoded tiered segments are stored as new objects, the previous objects are left in place
+func (m *MrT) rekeySegment(buf *bytes.Buffer, line []byte) (err error) {
+	var lines []byte
+	if lines, err = m.readSegmentLine(line); err != nil {
+		return
+	}
+
+	var rekeyed bytes.Buffer
+	if err = forEachLine(bytes.NewReader(lines), 0, func(line []byte, _ int64) error {
+		// Our line is a copy, it is safe to restore it's trailing newline
+		return m.rekeyLine(&rekeyed, append(line, '\n'))
+	}); err != nil {
+		return
+	}
+
+	if line[0] == TieredLine {
+		return m.tierSegment(buf, rekeyed.Bytes())
+	}
+
+	return m.writeSegment(buf, rekeyed.Bytes())
+}
@@ -0,0 +1,45 @@
+package mrT
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+func newContextReader(ctx context.Context, r io.Reader) *contextReader {
+	var cr contextReader
+	cr.ctx = ctx
+	cr.r = r
+	return &cr
+}
+
+// contextReader will stop reading once it's context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read will read from the underlying reader, the context's error is returned once it is done
+func (cr *contextReader) Read(b []byte) (n int, err error) {
+	if err = cr.ctx.Err(); err != nil {
+		return
+	}
+
+	return cr.r.Read(b)
+}
+
+// withContext will wrap a line func so iteration stops before the next line once the context is done
+func withContext(ctx context.Context, fn func(*bytes.Buffer) error) func(*bytes.Buffer) error {
+	if ctx.Done() == nil {
+		// Context can never be cancelled, avoid checking each line
+		return fn
+	}
+
+	return func(buf *bytes.Buffer) (err error) {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		return fn(buf)
+	}
+}
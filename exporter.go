@@ -1,13 +1,16 @@
 package mrT
 
 import (
+	"bytes"
+	"context"
 	"io"
 
 	"github.com/PathDNA/fileutils/shasher"
 	"github.com/itsmontoya/seeker"
 )
 
-func newExporter(m *MrT, w io.Writer, txnID string) (e exporter) {
+func newExporter(ctx context.Context, m *MrT, w io.Writer, txnID string) (e exporter) {
+	e.ctx = ctx
 	e.m = m
 	e.w = w
 	e.txnID = txnID
@@ -18,42 +21,117 @@ func newExporter(m *MrT, w io.Writer, txnID string) (e exporter) {
 
 type exporter struct {
 	txnID string
+	// Context which stops the export once done
+	ctx context.Context
 
 	m  *MrT
 	w  io.Writer
-	hw *shasher.HashWriter
+	hw exportWriter
 	mf *Match
+	// Number of lines exported
+	lines int64
 }
 
-func (e *exporter) exportFrom(rsc ReadSeekCloser) (err error) {
+// exportWriter writes the export stream and it's signature
+type exportWriter interface {
+	io.Writer
+	Sign() (sig []byte, err error)
+}
+
+// exportFrom will export the current file, lastTxn is the last transaction visible to the provided reader
+func (e *exporter) exportFrom(rsc ReadSeekCloser, lastTxn string) (err error) {
 	defer rsc.Close()
 	s := seeker.New(rsc)
 
-	var ltid string
-	if ltid, err = e.m.LastTxn(); err != nil {
+	if lastTxn == e.txnID {
+		return ErrNoTxn
+	}
+
+	// Find our target transaction
+	if err = e.seekToTransaction(s); err != nil {
+		return
+	}
+
+	if err = e.initHashWriter(); err != nil {
+		return
+	}
+
+	lr := lineCountReader{r: newContextReader(e.ctx, rsc)}
+	_, err = io.Copy(e.hw, &lr)
+	e.lines += lr.lines
+	if err != nil {
 		return
 	}
 
-	if ltid == e.txnID {
+	return
+}
+
+// exportLines will export the lines provided by the read func, starting at the first transaction after our match
+// Note: This is used for the archive, where lines may live within compressed segments
+func (e *exporter) exportLines(read func(fn func(*bytes.Buffer) error) error) (err error) {
+	var started bool
+	if err = read(withContext(e.ctx, func(buf *bytes.Buffer) (err error) {
+		var ok bool
+		if ok, err = e.mf.Filter(buf); !ok || err != nil {
+			return
+		}
+
+		if !started {
+			// Lines preceding the first transaction (such as the header) are not exported
+			if lineType, _ := getLineType(buf); lineType != TransactionLine {
+				return
+			}
+
+			started = true
+		}
+
+		if err = e.initHashWriter(); err != nil {
+			return
+		}
+
+		if _, err = e.hw.Write(buf.Bytes()); err != nil {
+			return
+		}
+
+		if _, err = e.hw.Write(newlineBytes); err != nil {
+			return
+		}
+
+		e.lines++
+		return
+	})); err != nil {
+		return
+	}
+
+	if e.mf.state == statePreMatch {
 		return ErrNoTxn
 	}
 
-	// Find our target transaction
-	if err = e.seekToTransaction(s); err != nil {
+	return
+}
+
+func (e *exporter) initHashWriter() (err error) {
+	if e.hw != nil {
 		return
 	}
 
-	if e.hw == nil {
-		// Hash writer hasn't been created yet, initialized hash writer
-		if e.hw, err = shasher.NewWithToken(e.w, e.m.getToken()); err != nil {
+	if e.m.signer != nil {
+		var sw *signedWriter
+		if sw, err = newSignedWriter(e.w, e.m.signer, e.m.getToken()); err != nil {
 			return
 		}
+
+		e.hw = sw
+		return
 	}
 
-	if _, err = io.Copy(e.hw, rsc); err != nil {
+	// Hash writer hasn't been created yet, initialized hash writer
+	var hw *shasher.HashWriter
+	if hw, err = shasher.NewWithToken(e.w, e.m.getToken()); err != nil {
 		return
 	}
 
+	e.hw = hw
 	return
 }
 
@@ -0,0 +1,35 @@
+package mrT
+
+import "expvar"
+
+// NewExpvarObserver will return an observer which publishes Prometheus-style counters within an expvar map
+// Note: expvar names are global, creating two observers with the same name will panic
+func NewExpvarObserver(name string) *ExpvarObserver {
+	var e ExpvarObserver
+	e.m = expvar.NewMap(name)
+	return &e
+}
+
+// ExpvarObserver publishes counters for each operation (e.g. txn_total, txn_errors_total,
+// txn_duration_seconds_sum, txn_bytes_total and txn_lines_total)
+type ExpvarObserver struct {
+	m *expvar.Map
+}
+
+// Observe will update the counters of the event's operation
+func (e *ExpvarObserver) Observe(ev Event) {
+	prefix := string(ev.Op) + "_"
+	e.m.Add(prefix+"total", 1)
+	if ev.Err != nil {
+		e.m.Add(prefix+"errors_total", 1)
+	}
+
+	e.m.AddFloat(prefix+"duration_seconds_sum", ev.Duration.Seconds())
+	e.m.Add(prefix+"bytes_total", ev.Bytes)
+	e.m.Add(prefix+"lines_total", ev.Lines)
+}
+
+// Map will return the expvar map our counters are published within
+func (e *ExpvarObserver) Map() *expvar.Map {
+	return e.m
+}
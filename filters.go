@@ -2,6 +2,8 @@ package mrT
 
 import (
 	"bytes"
+	"regexp"
+	"time"
 
 	"github.com/itsmontoya/seeker"
 )
@@ -20,13 +22,96 @@ type filter struct {
 
 func (f *filter) processLine(buf *bytes.Buffer) (err error) {
 	var ok bool
-	for _, ff := range f.fs {
-		if ok, err = ff.Filter(buf); !ok {
+	if ok, err = filterAll(f.fs, buf); !ok {
+		return
+	}
+
+	return f.fn(buf)
+}
+
+func newTxnFilter(txnID string, fn ForEachTxnFn, fs []Filter, decode decodeFn, log Logger) *txnFilter {
+	var f txnFilter
+	f.fn = fn
+	f.fs = fs
+	f.fe = newTxnForEacher(txnID, f.flush, decode, log)
+	return &f
+}
+
+// txnFilter will include or drop entire transactions, a transaction is included when any of it's actions pass the filters
+type txnFilter struct {
+	fn ForEachTxnFn
+	fs []Filter
+	fe *txnForEacher
+
+	// Whether or not an action within the current transaction has passed the filters
+	matched bool
+}
+
+func (f *txnFilter) flush(ti *TxnInfo) (err error) {
+	if !f.matched {
+		return
+	}
+
+	return f.fn(ti)
+}
+
+func (f *txnFilter) processLine(buf *bytes.Buffer) (err error) {
+	var (
+		lineType byte
+		ok       bool
+	)
+
+	if lineType, err = getLineType(buf); err != nil {
+		return
+	}
+
+	// Filters are always called so stateful filters can track their transaction
+	if ok, err = filterAll(f.fs, buf); err != nil {
+		return
+	}
+
+	switch lineType {
+	case TransactionLine, ReplayLine:
+		// Process the line first so the previous transaction is flushed with it's own match state
+		if err = f.fe.processLine(buf); err != nil {
 			return
 		}
+
+		f.matched = false
+		return
+
+	case PutLine, DeleteLine, BucketPutLine, BucketDeleteLine:
+		if ok {
+			f.matched = true
+		}
 	}
 
-	return f.fn(buf)
+	return f.fe.processLine(buf)
+}
+
+// filterAll will call every filter and return whether or not the line passed all of them
+// Note: Filters do not short-circuit, this ensures stateful filters see every line
+func filterAll(fs []Filter, buf *bytes.Buffer) (ok bool, err error) {
+	ok = true
+	for _, f := range fs {
+		var fok bool
+		if fok, err = f.Filter(buf); err != nil {
+			return false, err
+		}
+
+		ok = ok && fok
+	}
+
+	return
+}
+
+// setFiltersDecoder will set the decoder for any filters which need to decode keys
+func setFiltersDecoder(fs []Filter, decode decodeFn) {
+	for _, f := range fs {
+		if df, ok := f.(decoderFilter); ok {
+			df.setDecoder(decode)
+		}
+	}
 }
 
 // Filter is a basic filtering interface
@@ -37,6 +122,11 @@ type Filter interface {
 // FilterFn  is a basic filter fn
 type FilterFn func(*bytes.Buffer) error
 
+// decoderFilter is implemented by filters which need to decode put and delete lines
+type decoderFilter interface {
+	setDecoder(decode decodeFn)
+}
+
 // NewMatch will return a new match filter
 func NewMatch(txnID string) *Match {
 	var m Match
@@ -86,7 +176,10 @@ func (m *Match) Filter(buf *bytes.Buffer) (ok bool, err error) {
 
 	case PutLine:
 	case DeleteLine:
+	case BucketPutLine:
+	case BucketDeleteLine:
 	case CommentLine:
+	case HeaderLine:
 
 	default:
 		err = ErrInvalidLine
@@ -108,3 +201,273 @@ func (m *Match) breakOnMatch(buf *bytes.Buffer) (err error) {
 
 	return
 }
+
+// newKeyFilter will return a new key filter
+func newKeyFilter(match func(key []byte) bool) (k keyFilter) {
+	// Lines are decoded raw until we are given the decoder of our database
+	k.decode = decodeRawKV
+	k.match = match
+	return
+}
+
+// decodeRawKV will decode the key and value of a payload written without middlewares
+func decodeRawKV(buf *bytes.Buffer, cor bool) (key, val []byte, err error) {
+	return getKV(buf.Bytes())
+}
+
+// keyFilter is the base for filters which match put and delete lines (including bucket lines) by key
+// Note: All other line types will pass
+type keyFilter struct {
+	decode decodeFn
+	match  func(key []byte) bool
+}
+
+func (k *keyFilter) setDecoder(decode decodeFn) {
+	k.decode = decode
+}
+
+// Filter interface fulfillment
+func (k *keyFilter) Filter(buf *bytes.Buffer) (ok bool, err error) {
+	var lineType byte
+	if lineType, err = getLineType(buf); err != nil {
+		return
+	}
+
+	var payload []byte
+	switch lineType {
+	case PutLine, DeleteLine:
+		payload = buf.Bytes()[1:]
+	case BucketPutLine, BucketDeleteLine:
+		if _, payload, err = getBucket(buf.Bytes()[1:]); err != nil {
+			return
+		}
+	default:
+		return true, nil
+	}
+
+	// Decode from a copy of the payload so we do not consume the line
+	var key []byte
+	if key, _, err = k.decode(bytes.NewBuffer(payload), false); err != nil {
+		return
+	}
+
+	ok = k.match(key)
+	return
+}
+
+// NewKeyPrefix will return a new key prefix filter
+func NewKeyPrefix(prefix []byte) *KeyPrefix {
+	var k KeyPrefix
+	k.keyFilter = newKeyFilter(func(key []byte) bool {
+		return bytes.HasPrefix(key, prefix)
+	})
+
+	return &k
+}
+
+// KeyPrefix is a filter which matches put and delete lines with keys starting with a prefix
+type KeyPrefix struct {
+	keyFilter
+}
+
+// NewKeyRegex will return a new key regex filter
+func NewKeyRegex(re *regexp.Regexp) *KeyRegex {
+	var k KeyRegex
+	k.keyFilter = newKeyFilter(re.Match)
+	return &k
+}
+
+// KeyRegex is a filter which matches put and delete lines with keys matching a regular expression
+type KeyRegex struct {
+	keyFilter
+}
+
+// NewLineTypes will return a new line types filter
+func NewLineTypes(lineTypes ...byte) *LineTypes {
+	var l LineTypes
+	l.lineTypes = lineTypes
+	return &l
+}
+
+// LineTypes is a filter which matches lines of the provided types
+type LineTypes struct {
+	lineTypes []byte
+}
+
+// Filter interface fulfillment
+func (l *LineTypes) Filter(buf *bytes.Buffer) (ok bool, err error) {
+	var lineType byte
+	if lineType, err = getLineType(buf); err != nil {
+		return
+	}
+
+	ok = bytes.IndexByte(l.lineTypes, lineType) > -1
+	return
+}
+
+// newTxnLevelFilter will return a new transaction level filter
+func newTxnLevelFilter(match func(txnID string) (bool, error)) (t txnLevelFilter) {
+	t.match = match
+	return
+}
+
+// txnLevelFilter is the base for filters which match entire transactions
+// Note: Lines within a transaction inherit the match state of their transaction line
+type txnLevelFilter struct {
+	match func(txnID string) (bool, error)
+	// Match state of the current transaction
+	ok bool
+}
+
+// Filter interface fulfillment
+func (t *txnLevelFilter) Filter(buf *bytes.Buffer) (ok bool, err error) {
+	var lineType byte
+	if lineType, err = getLineType(buf); err != nil {
+		return
+	}
+
+	if lineType == TransactionLine || lineType == ReplayLine {
+		txnID := getKey(buf.Bytes()[1:])
+		if txnID == "" {
+			// The replay line of an archived empty file is not a transaction, it's block never matches
+			t.ok = false
+		} else if t.ok, err = t.match(txnID); err != nil {
+			return
+		}
+	}
+
+	ok = t.ok
+	return
+}
+
+// NewTimeRange will return a new time range filter, from and to are inclusive
+// Note: Time range filters are stateful and should not be shared between iterations
+func NewTimeRange(from, to time.Time) *TimeRange {
+	var t TimeRange
+	t.txnLevelFilter = newTxnLevelFilter(func(txnID string) (ok bool, err error) {
+		var ts time.Time
+		if ts, err = getTxnTime(txnID); err != nil {
+			return
+		}
+
+		ok = !ts.Before(from) && !ts.After(to)
+		return
+	})
+
+	return &t
+}
+
+// TimeRange is a filter which matches transactions which occurred within a time range
+type TimeRange struct {
+	txnLevelFilter
+}
+
+// NewTxnIDs will return a new transaction ids filter
+// Note: Transaction id filters are stateful and should not be shared between iterations
+func NewTxnIDs(txnIDs ...string) *TxnIDs {
+	var t TxnIDs
+	set := make(map[string]struct{}, len(txnIDs))
+	for _, txnID := range txnIDs {
+		set[txnID] = struct{}{}
+	}
+
+	t.txnLevelFilter = newTxnLevelFilter(func(txnID string) (ok bool, err error) {
+		_, ok = set[txnID]
+		return
+	})
+
+	return &t
+}
+
+// TxnIDs is a filter which matches the provided transactions
+type TxnIDs struct {
+	txnLevelFilter
+}
+
+// NewAnd will return a new and filter
+func NewAnd(fs ...Filter) *And {
+	var a And
+	a.fs = fs
+	return &a
+}
+
+// And is a filter which matches lines that pass all of it's filters
+type And struct {
+	fs []Filter
+}
+
+func (a *And) setDecoder(decode decodeFn) {
+	setFiltersDecoder(a.fs, decode)
+}
+
+// Filter interface fulfillment
+func (a *And) Filter(buf *bytes.Buffer) (ok bool, err error) {
+	return filterAll(a.fs, buf)
+}
+
+// NewOr will return a new or filter
+func NewOr(fs ...Filter) *Or {
+	var o Or
+	o.fs = fs
+	return &o
+}
+
+// Or is a filter which matches lines that pass any of it's filters
+type Or struct {
+	fs []Filter
+}
+
+func (o *Or) setDecoder(decode decodeFn) {
+	setFiltersDecoder(o.fs, decode)
+}
+
+// Filter interface fulfillment
+func (o *Or) Filter(buf *bytes.Buffer) (ok bool, err error) {
+	// Filters do not short-circuit, this ensures stateful filters see every line
+	for _, f := range o.fs {
+		var fok bool
+		if fok, err = f.Filter(buf); err != nil {
+			return false, err
+		}
+
+		ok = ok || fok
+	}
+
+	return
+}
+
+// NewNot will return a new not filter
+func NewNot(f Filter) *Not {
+	var n Not
+	n.f = f
+	return &n
+}
+
+// Not is a filter which matches put and delete lines that do not pass it's filter
+// Note: All other line types will pass so transaction boundaries are kept
+type Not struct {
+	f Filter
+}
+
+func (n *Not) setDecoder(decode decodeFn) {
+	setFiltersDecoder([]Filter{n.f}, decode)
+}
+
+// Filter interface fulfillment
+func (n *Not) Filter(buf *bytes.Buffer) (ok bool, err error) {
+	// Our filter is always called so stateful filters can track their transaction
+	if ok, err = n.f.Filter(buf); err != nil {
+		return
+	}
+
+	var lineType byte
+	if lineType, err = getLineType(buf); err != nil {
+		return
+	}
+
+	if !isActionLine(lineType) {
+		return true, nil
+	}
+
+	return !ok, nil
+}
@@ -0,0 +1,33 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package mrT
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile will acquire an exclusive flock on the file, ErrLocked is returned when another handle holds the lock
+// Note: flock locks belong to the open file, a second open within the same process will also be refused
+func lockFile(name string) (f *os.File, err error) {
+	if f, err = os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644); err != nil {
+		return
+	}
+
+	for {
+		if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != syscall.EINTR {
+			break
+		}
+	}
+
+	if err == syscall.EWOULDBLOCK {
+		err = ErrLocked
+	}
+
+	if err != nil {
+		f.Close()
+		f = nil
+	}
+
+	return
+}
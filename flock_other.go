@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package mrT
+
+import "os"
+
+// lockFile will create the lock file without locking it
+// Note: OS-level locking is not supported on this platform, a second writer is NOT refused. The caller must ensure
+// only a single writer opens a database (see Opts.ReadOnly)
+func lockFile(name string) (f *os.File, err error) {
+	return os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+}
@@ -0,0 +1,259 @@
+package mrT
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/itsmontoya/seeker"
+)
+
+// followState is the state of a read-only database's files, used to detect the changes made by it's writer
+type followState struct {
+	// Offset following the last complete line of the current file
+	size int64
+	// Size of the archive, the archive only changes when the current file is rotated or rekeyed
+	archiveSize int64
+	// First transaction (or replay) id of the current file, changes when the current file is rotated
+	first string
+}
+
+// follow will pick up the changes made to a read-only database by it's writer
+// Note: Appended lines are followed incrementally, a rotated current file rebuilds our state
+func (m *MrT) follow() (err error) {
+	if !m.readOnly {
+		return
+	}
+
+	m.folMux.Lock()
+	defer m.folMux.Unlock()
+
+	cr := m.f.Reader()
+	defer cr.Close()
+	ar := m.af.Reader()
+	defer ar.Close()
+
+	var state followState
+	if state, err = getFollowState(cr, ar); err != nil {
+		return
+	}
+
+	switch {
+	case state.archiveSize != m.fol.archiveSize, state.first != m.fol.first, state.size < m.fol.size:
+		// The current file has been rotated (or truncated), rebuild our state
+		if err = m.idx.rebuild(func() (err error) {
+			if _, err = ar.Seek(0, io.SeekStart); err == nil {
+				err = m.idx.indexLines(m, ar, true, 0)
+			}
+
+			if os.IsNotExist(err) {
+				err = nil
+			}
+
+			return
+		}); err != nil {
+			return
+		}
+
+		m.ltxn.Store("")
+		m.stats.reset()
+		m.log.Info("followed rotated current file", "name", m.name)
+		state.size, err = m.followLines(cr, 0)
+	case state.size > m.fol.size:
+		// Lines have been appended
+		state.size, err = m.followLines(cr, m.fol.size)
+	default:
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	m.fol = state
+	return
+}
+
+// followLines will index the complete lines of the current file following offset and update our last transaction,
+// the offset following the last complete line is returned
+func (m *MrT) followLines(cr File, offset int64) (end int64, err error) {
+	if _, err = cr.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+
+	var b []byte
+	if b, err = ioutil.ReadAll(cr); err != nil {
+		return
+	}
+
+	// The writer is still writing anything following our complete transactions, it will be followed once complete
+	b = b[:getCompleteSize(b)]
+	end = offset + int64(len(b))
+
+	if err = m.idx.index(m, bytes.NewReader(b), false, offset); err != nil {
+		return
+	}
+
+	m.stats.add(m, bytes.NewReader(b))
+
+	err = forEachLine(bytes.NewReader(b), offset, func(line []byte, _ int64) (err error) {
+		if len(line) == 0 || (line[0] != TransactionLine && line[0] != ReplayLine) {
+			return
+		}
+
+		var key []byte
+		if key, _, err = getKV(line[1:]); err != nil {
+			return
+		}
+
+		m.ltxn.Store(string(key))
+		return
+	})
+
+	return
+}
+
+// getCompleteSize will return the size of the complete transactions at the start of b
+// Note: Transactions written before sizes were recorded are considered complete at each line
+func getCompleteSize(b []byte) (size int64) {
+	// Size of the data lines remaining within the transaction being read
+	var remaining int64
+	forEachLine(bytes.NewReader(b), 0, func(line []byte, offset int64) error {
+		end := offset + int64(len(line)) + 1
+		if len(line) > 0 && line[0] == TransactionLine {
+			remaining = 0
+			if _, value, err := getKV(line[1:]); err == nil {
+				remaining, _ = getTxnSize(value)
+			}
+		} else {
+			remaining -= end - offset
+		}
+
+		if remaining <= 0 {
+			remaining = 0
+			size = end
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// getFollowState will return the state of the provided current and archive files
+// Note: The size of the current file includes any trailing partial line
+func getFollowState(cr, ar File) (state followState, err error) {
+	if state.archiveSize, err = ar.Seek(0, io.SeekEnd); os.IsNotExist(err) {
+		// The writer has not archived yet
+		err = nil
+	} else if err != nil {
+		return
+	}
+
+	if state.size, err = cr.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+
+	if _, err = cr.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	err = forEachLine(cr, 0, func(line []byte, _ int64) (err error) {
+		if len(line) == 0 || (line[0] != TransactionLine && line[0] != ReplayLine) {
+			return
+		}
+
+		var key []byte
+		if key, _, err = getKV(line[1:]); err != nil {
+			return
+		}
+
+		state.first = string(key)
+		return seeker.ErrEndEarly
+	})
+
+	if err == seeker.ErrEndEarly {
+		err = nil
+	}
+
+	return
+}
+
+// reader will return a shared reader of the current file
+// Note: Read-only readers are capped at the lines we have followed, a transaction our writer is part way through
+// writing is not visible until it has been followed
+func (m *MrT) reader() (r *fileReader) {
+	r, _ = m.lastTxnReader()
+	return
+}
+
+// lastTxnReader will return a shared reader of the current file along with the last transaction visible to it
+// Note: Our follow state is loaded before the reader is acquired, follow holds it's lock while acquiring readers
+func (m *MrT) lastTxnReader() (r *fileReader, lastTxn string) {
+	if !m.readOnly {
+		r = m.f.Reader()
+		// Transactions are blocked while we hold our reader, our last transaction will not change
+		lastTxn = m.ltxn.Load()
+		return
+	}
+
+	// Our last transaction is loaded alongside our cap so it never refers to a line beyond our reader
+	m.folMux.Lock()
+	size := m.fol.size
+	lastTxn = m.ltxn.Load()
+	m.folMux.Unlock()
+
+	r = capReader(m.f.Reader(), size)
+	return
+}
+
+// archiveReader will return a shared reader of the archive
+// Note: Read-only readers are capped at the archive size we have followed
+func (m *MrT) archiveReader() (r *fileReader) {
+	if !m.readOnly {
+		return m.af.Reader()
+	}
+
+	m.folMux.Lock()
+	size := m.fol.archiveSize
+	m.folMux.Unlock()
+
+	return capReader(m.af.Reader(), size)
+}
+
+// capReader will cap a reader at the provided size
+func capReader(r *fileReader, size int64) *fileReader {
+	if _, ok := r.File.(failedFile); ok {
+		// Our open error is returned by the handle as is
+		return r
+	}
+
+	r.File = newCappedFile(r.File, size)
+	return r
+}
+
+func newCappedFile(f File, size int64) *cappedFile {
+	var c cappedFile
+	c.File = f
+	c.sr = io.NewSectionReader(f, 0, size)
+	return &c
+}
+
+// cappedFile is a handle which only reads the first size bytes of it's file
+type cappedFile struct {
+	File
+	sr *io.SectionReader
+}
+
+func (c *cappedFile) Read(b []byte) (int, error) {
+	return c.sr.Read(b)
+}
+
+func (c *cappedFile) ReadAt(b []byte, offset int64) (int, error) {
+	return c.sr.ReadAt(b, offset)
+}
+
+func (c *cappedFile) Seek(offset int64, whence int) (int64, error) {
+	return c.sr.Seek(offset, whence)
+}
@@ -6,7 +6,6 @@ import (
 	"io/ioutil"
 
 	"github.com/itsmontoya/middleware"
-	"github.com/missionMeteora/journaler"
 	"github.com/missionMeteora/uuid"
 )
 
@@ -22,11 +21,12 @@ const (
 	statePostMatch
 )
 
-func newTxnForEacher(tid string, fn ForEachTxnFn, mw *middleware.MWs) *txnForEacher {
+func newTxnForEacher(tid string, fn ForEachTxnFn, decode decodeFn, log Logger) *txnForEacher {
 	var fe txnForEacher
 	fe.tid = tid
 	fe.fn = fn
-	fe.mw = mw
+	fe.decode = decode
+	fe.log = log
 
 	if tid == "" {
 		fe.state = statePostMatch
@@ -41,20 +41,26 @@ type txnForEacher struct {
 	tid string
 	fn  ForEachTxnFn
 	ti  *TxnInfo
-	mw  *middleware.MWs
+	// Put and delete decoder
+	decode decodeFn
+	// Logger of malformed transactions
+	log Logger
 	// Match state
 	state forEachState
+	// Skip replay blocks, used when iterating through history
+	skipReplay bool
 }
 
-func (fe *txnForEacher) flush() {
+func (fe *txnForEacher) flush() (err error) {
 	if fe.ti == nil {
 		return
 	}
 
 	// A transaction item already exists, let's pass it to the func!
 	// Note: We will be replacing this with the other new function at the end of this case
-	fe.fn(fe.ti)
+	err = fe.fn(fe.ti)
 	fe.ti = nil
+	return
 }
 
 func (fe *txnForEacher) processLine(buf *bytes.Buffer) (err error) {
@@ -72,9 +78,25 @@ func (fe *txnForEacher) processLine(buf *bytes.Buffer) (err error) {
 	// Switch on the first byte (line indicator)
 	switch lineType {
 	case TransactionLine, ReplayLine:
-		fe.flush()
+		if err = fe.flush(); err != nil {
+			return
+		}
+
+		if lineType == ReplayLine && fe.skipReplay {
+			// Replay blocks are snapshots rather than changes, ignore the actions within
+			return
+		}
+
 		// Extract transaction id from the key
-		tid, _ = getKV(buf.Bytes())
+		if tid, _, err = getKV(buf.Bytes()); err != nil {
+			return
+		}
+
+		if len(tid) == 0 {
+			// The replay block of an archived empty file has no transaction id, there is no transaction to report
+			return
+		}
+
 		if fe.state == statePreMatch {
 			if fe.tid == string(tid) {
 				fe.state = stateMatch
@@ -89,7 +111,7 @@ func (fe *txnForEacher) processLine(buf *bytes.Buffer) (err error) {
 		var tu uuid.UUID
 		if tu, err = uuid.ParseStr(string(tid)); err != nil {
 			// Something is definitely wrong here (almost enough to panic)
-			journaler.Error("Error parsing transaction: %v", err)
+			fe.log.Error("error parsing transaction", "txn", string(tid), "error", err)
 			return
 		}
 
@@ -98,7 +120,7 @@ func (fe *txnForEacher) processLine(buf *bytes.Buffer) (err error) {
 			TS: tu.Time().Unix(),
 		}
 
-	case CommentLine:
+	case CommentLine, HeaderLine:
 	case PutLine, DeleteLine:
 		if fe.ti == nil {
 			return
@@ -108,12 +130,34 @@ func (fe *txnForEacher) processLine(buf *bytes.Buffer) (err error) {
 			return
 		}
 
-		if key, value, err = getProcessedKV(buf, fe.mw, true); err != nil {
+		if key, value, err = fe.decode(buf, true); err != nil {
 			return
 		}
 
 		fe.ti.Actions = append(fe.ti.Actions, newActionInfo(lineType == PutLine, key, value))
 
+	case BucketPutLine, BucketDeleteLine:
+		if fe.ti == nil {
+			return
+		}
+
+		if fe.state != statePostMatch {
+			return
+		}
+
+		var bucket, payload []byte
+		if bucket, payload, err = getBucket(buf.Bytes()); err != nil {
+			return
+		}
+
+		if key, value, err = fe.decode(bytes.NewBuffer(payload), true); err != nil {
+			return
+		}
+
+		ai := newActionInfo(lineType == BucketPutLine, key, value)
+		ai.Bucket = string(bucket)
+		fe.ti.Actions = append(fe.ti.Actions, ai)
+
 	default:
 		err = ErrInvalidLine
 		return
@@ -122,9 +166,10 @@ func (fe *txnForEacher) processLine(buf *bytes.Buffer) (err error) {
 	return
 }
 
-type forEachKVFn func(buf *bytes.Buffer, mw *middleware.MWs, cor bool) (key, val []byte, err error)
+// decodeFn is used to decode the key and value of put and delete payloads
+type decodeFn func(buf *bytes.Buffer, cor bool) (key, val []byte, err error)
 
-func getProcessedKV(buf *bytes.Buffer, mw *middleware.MWs, cor bool) (key, val []byte, err error) {
+func getProcessedKV(buf *bytes.Buffer, mw *middleware.MWs, cor bool, lim sizeLimits) (key, val []byte, err error) {
 	var b []byte
 	if mw != nil {
 		var r io.Reader
@@ -132,18 +177,25 @@ func getProcessedKV(buf *bytes.Buffer, mw *middleware.MWs, cor bool) (key, val [
 			return
 		}
 
-		if b, err = ioutil.ReadAll(r); err != nil {
+		// Limit our read so a corrupt or malicious payload cannot exhaust memory
+		max := lim.payloadSize()
+		if b, err = ioutil.ReadAll(io.LimitReader(r, max+1)); err != nil {
+			return
+		}
+
+		if int64(len(b)) > max {
+			err = newRecordError(ErrLengthOverflow, 0)
 			return
 		}
 	} else {
 		b = buf.Bytes()
 	}
 
-	if !cor {
-		key, val = getKV(b)
-	} else {
-		key, val = getKVSafe(b)
+	if key, val, err = lim.parseKV(b); err != nil || !cor {
+		return
 	}
 
+	key = append([]byte{}, key...)
+	val = append([]byte{}, val...)
 	return
 }
@@ -0,0 +1,144 @@
+package mrT
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/itsmontoya/seeker"
+)
+
+const (
+	// FormatVersion is the current file format version
+	FormatVersion = 1
+)
+
+var (
+	headerKey = []byte("mrT")
+)
+
+func newHeader(name string, mws []string, keyRing, policy bool) (h Header) {
+	h.Version = FormatVersion
+	h.Name = name
+	h.Middlewares = mws
+	h.KeyRing = keyRing
+	h.Policy = policy
+	h.Created = time.Now().UnixNano()
+	return
+}
+
+// Header is the metadata record written at the top of each file
+type Header struct {
+	// File format version
+	Version int `json:"version"`
+	// Database name
+	Name string `json:"name"`
+	// Middleware identifiers, in order of application
+	Middlewares []string `json:"middlewares"`
+	// Whether or not puts and deletes reference a key ring key id
+	KeyRing bool `json:"keyRing,omitempty"`
+	// Whether or not puts and deletes contain middleware flags
+	Policy bool `json:"policy,omitempty"`
+	// Shared compression dictionary (optional)
+	Dictionary []byte `json:"dictionary,omitempty"`
+	// Creation time (in unix nanoseconds)
+	Created int64 `json:"created"`
+}
+
+// CreatedAt will return the creation time
+func (h *Header) CreatedAt() time.Time {
+	return time.Unix(0, h.Created)
+}
+
+// validate will ensure the provided (stored) header is compatible with our header
+func (h *Header) validate(stored *Header) (err error) {
+	if stored.Version > h.Version {
+		return newHeaderError("version", fmt.Sprint(h.Version), fmt.Sprint(stored.Version))
+	}
+
+	if stored.Name != h.Name {
+		return newHeaderError("name", h.Name, stored.Name)
+	}
+
+	expected := strings.Join(h.Middlewares, ",")
+	found := strings.Join(stored.Middlewares, ",")
+	if expected != found {
+		return newHeaderError("middlewares", expected, found)
+	}
+
+	if stored.KeyRing != h.KeyRing {
+		return newHeaderError("keyRing", fmt.Sprint(h.KeyRing), fmt.Sprint(stored.KeyRing))
+	}
+
+	if stored.Policy != h.Policy {
+		return newHeaderError("policy", fmt.Sprint(h.Policy), fmt.Sprint(stored.Policy))
+	}
+
+	if h.Dictionary != nil && !bytes.Equal(stored.Dictionary, h.Dictionary) {
+		// Dictionaries are compared by checksum to keep our error readable
+		expected := fmt.Sprintf("%08x", crc32.ChecksumIEEE(h.Dictionary))
+		found := fmt.Sprintf("%08x", crc32.ChecksumIEEE(stored.Dictionary))
+		return newHeaderError("dictionary", expected, found)
+	}
+
+	return
+}
+
+func newHeaderError(field, expected, found string) *HeaderError {
+	var e HeaderError
+	e.Field = field
+	e.Expected = expected
+	e.Found = found
+	return &e
+}
+
+// HeaderError is returned when a file header does not match the configuration MrT was opened with
+type HeaderError struct {
+	// Header field which did not match
+	Field string
+	// Expected value
+	Expected string
+	// Value found within the file
+	Found string
+}
+
+// Error will return the error string
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("header mismatch for %s, expected \"%s\" and found \"%s\"", e.Field, e.Expected, e.Found)
+}
+
+// readHeader will read the header from the top of a file
+// Note: A nil header will be returned for files created before headers existed
+func readHeader(r io.ReadSeeker) (hdr *Header, err error) {
+	s := seeker.New(r)
+	if err = s.SeekToStart(); err != nil {
+		return
+	}
+
+	if err = s.ReadLine(func(buf *bytes.Buffer) (err error) {
+		var lineType byte
+		if lineType, err = buf.ReadByte(); err != nil {
+			return
+		}
+
+		if lineType != HeaderLine {
+			return
+		}
+
+		var value []byte
+		if _, value, err = getKV(buf.Bytes()); err != nil {
+			return
+		}
+
+		hdr = &Header{}
+		return json.Unmarshal(value, hdr)
+	}); err == io.EOF {
+		err = nil
+	}
+
+	return
+}
@@ -0,0 +1,180 @@
+package mrT
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/itsmontoya/seeker"
+)
+
+// Action is a put or delete action of a transaction
+type Action = ActionInfo
+
+// BeforeCommitFn is called with the actions of a transaction before it is appended, returning an error aborts the transaction
+type BeforeCommitFn func(txnID string, actions []Action) error
+
+// AfterCommitFn is called with a transaction once it has been synced
+type AfterCommitFn func(ti *TxnInfo)
+
+// hooks are our registered commit hooks
+type hooks struct {
+	mux    sync.RWMutex
+	before []BeforeCommitFn
+	after  []AfterCommitFn
+}
+
+func (h *hooks) addBefore(fn BeforeCommitFn) {
+	h.mux.Lock()
+	h.before = append(h.before, fn)
+	h.mux.Unlock()
+}
+
+func (h *hooks) addAfter(fn AfterCommitFn) {
+	h.mux.Lock()
+	h.after = append(h.after, fn)
+	h.mux.Unlock()
+}
+
+// isSet will return whether or not any hooks have been registered
+func (h *hooks) isSet() (set bool) {
+	h.mux.RLock()
+	set = len(h.before) > 0 || len(h.after) > 0
+	h.mux.RUnlock()
+	return
+}
+
+// beforeCommit will call each before commit hook in order of registration, stopping at the first error
+func (h *hooks) beforeCommit(txnID string, actions []*ActionInfo) (err error) {
+	h.mux.RLock()
+	fns := h.before
+	h.mux.RUnlock()
+	if len(fns) == 0 {
+		return
+	}
+
+	// Our hooks receive copies so the actions passed to our after commit hooks cannot be altered
+	as := make([]Action, len(actions))
+	for i, a := range actions {
+		as[i] = *a
+	}
+
+	for _, fn := range fns {
+		if err = fn(txnID, as); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// afterCommit will call each after commit hook in order of registration
+func (h *hooks) afterCommit(ti *TxnInfo) {
+	h.mux.RLock()
+	fns := h.after
+	h.mux.RUnlock()
+
+	for _, fn := range fns {
+		fn(ti)
+	}
+}
+
+// newCommit will return a commit recording the actions of a transaction, nil is returned when no hooks are registered
+func (m *MrT) newCommit() *commit {
+	if !m.hooks.isSet() {
+		return nil
+	}
+
+	var c commit
+	c.m = m
+	return &c
+}
+
+// newTxn will return a transaction writing to buf, the actions are recorded by the commit (when set)
+func (m *MrT) newTxn(buf *bytes.Buffer, c *commit) Txn {
+	if c == nil {
+		return newTxn(buf, m.writeLine, m.writeBucketLine)
+	}
+
+	return newTxn(buf, c.writeLine, c.writeBucketLine)
+}
+
+// commit records the actions of a transaction (or replay block) for our commit hooks
+// Note: A nil commit is valid, it's hooks are no-ops
+type commit struct {
+	m       *MrT
+	txnID   string
+	actions []*ActionInfo
+}
+
+func (c *commit) writeLine(buf *bytes.Buffer, lineType byte, key, value []byte) (err error) {
+	if err = c.m.writeLine(buf, lineType, key, value); err != nil || !isActionLine(lineType) {
+		return
+	}
+
+	c.actions = append(c.actions, newActionInfo(lineType == PutLine, key, value))
+	return
+}
+
+func (c *commit) writeBucketLine(buf *bytes.Buffer, lineType byte, bucket, key, value []byte) (err error) {
+	if err = c.m.writeBucketLine(buf, lineType, bucket, key, value); err != nil {
+		return
+	}
+
+	ai := newActionInfo(lineType == BucketPutLine, key, value)
+	ai.Bucket = string(bucket)
+	c.actions = append(c.actions, ai)
+	return
+}
+
+// before will call our before commit hooks for the provided transaction id
+func (c *commit) before(txnID string) (err error) {
+	if c == nil {
+		return
+	}
+
+	c.txnID = txnID
+	return c.m.hooks.beforeCommit(txnID, c.actions)
+}
+
+// after will call our after commit hooks
+func (c *commit) after() {
+	if c == nil {
+		return
+	}
+
+	c.m.hooks.afterCommit(newCommitInfo(c.txnID, c.actions))
+}
+
+// newCommitInfo will return the transaction info of a commit
+// Note: The timestamp is left unset when the id is not a transaction id (e.g. the replay block of an empty file)
+func newCommitInfo(txnID string, actions []*ActionInfo) (ti *TxnInfo) {
+	var err error
+	if ti, err = newTxnInfo(txnID); err != nil {
+		ti = &TxnInfo{ID: txnID}
+	}
+
+	ti.Actions = actions
+	return
+}
+
+// forEachImportTxn will call fn for each transaction within an import payload
+// Note: Replay blocks are snapshots rather than changes, they are skipped. The payload is reset to the start once complete
+func (m *MrT) forEachImportTxn(f File, fn ForEachTxnFn) (err error) {
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	fe := newTxnForEacher("", fn, m.decodeKV, m.log)
+	fe.skipReplay = true
+	if err = seeker.New(f).ReadLines(fe.processLine); err != nil {
+		return
+	}
+
+	if err = fe.flush(); err != nil {
+		return
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	return
+}
@@ -0,0 +1,220 @@
+package mrT
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// keyRef is the location of a put or delete line
+type keyRef struct {
+	// Transaction id the line belongs to
+	txnID string
+	// Whether or not the line lives within the archive
+	archived bool
+	// Offset of the line within it's file
+	offset int64
+	// Whether or not the line lives within a compressed segment
+	segmented bool
+	// Offset of the line within it's segment
+	inner int64
+}
+
+// keyIndex is an optional secondary index of line locations by key
+type keyIndex struct {
+	mux sync.RWMutex
+	// Whether or not the index has been enabled
+	enabled bool
+	// Line references by bucket and key
+	refs map[string][]keyRef
+}
+
+// indexKey will return the index key of a key within a bucket, keys outside of buckets have an empty bucket
+func indexKey(bucket, key []byte) string {
+	return string(bucket) + "\x00" + string(key)
+}
+
+func (k *keyIndex) isEnabled() (enabled bool) {
+	k.mux.RLock()
+	enabled = k.enabled
+	k.mux.RUnlock()
+	return
+}
+
+// enable will enable the index and populate it using the provided func
+func (k *keyIndex) enable(populate func() error) (err error) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if k.enabled {
+		return
+	}
+
+	k.refs = make(map[string][]keyRef)
+	if err = populate(); err != nil {
+		k.refs = nil
+		return
+	}
+
+	k.enabled = true
+	return
+}
+
+// index will index the lines read from the provided reader
+// Note: Offset is the file offset of the first byte within the reader
+func (k *keyIndex) index(m *MrT, r io.Reader, archived bool, offset int64) (err error) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if !k.enabled {
+		return
+	}
+
+	return k.indexLines(m, r, archived, offset)
+}
+
+// indexLines will index the lines read from the provided reader, the caller is expected to hold the lock
+func (k *keyIndex) indexLines(m *MrT, r io.Reader, archived bool, offset int64) (err error) {
+	var txnID string
+	return forEachLine(r, offset, func(line []byte, lineOffset int64) (err error) {
+		ref := keyRef{archived: archived, offset: lineOffset}
+		if len(line) == 0 || !isSegmentLine(line[0]) {
+			return k.indexLine(m, line, &txnID, ref)
+		}
+
+		var lines []byte
+		if lines, err = m.readSegmentLine(line); err != nil {
+			return
+		}
+
+		ref.segmented = true
+		return forEachLine(bytes.NewReader(lines), 0, func(line []byte, inner int64) error {
+			ref.inner = inner
+			return k.indexLine(m, line, &txnID, ref)
+		})
+	})
+}
+
+// indexLine will index a single line, txnID is the transaction id of the line's transaction block
+func (k *keyIndex) indexLine(m *MrT, line []byte, txnID *string, ref keyRef) (err error) {
+	var (
+		lineType byte
+		key      []byte
+	)
+
+	if lineType, key, _, err = m.processLine(bytes.NewBuffer(line)); err != nil {
+		return
+	}
+
+	switch lineType {
+	case TransactionLine:
+		*txnID = string(key)
+	case ReplayLine:
+		// Replay blocks are snapshots rather than changes, we do not index them
+		*txnID = ""
+	case PutLine, DeleteLine, BucketPutLine, BucketDeleteLine:
+		if *txnID == "" {
+			return
+		}
+
+		var bucket []byte
+		if bucket, err = lineBucket(line); err != nil {
+			return
+		}
+
+		ik := indexKey(bucket, key)
+		ref.txnID = *txnID
+		k.refs[ik] = append(k.refs[ik], ref)
+	}
+
+	return
+}
+
+// rebuild will repopulate an enabled index using the provided func
+func (k *keyIndex) rebuild(populate func() error) (err error) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if !k.enabled {
+		return
+	}
+
+	k.refs = make(map[string][]keyRef)
+	return populate()
+}
+
+// newRotation will return a remap func which moves the current file references to the archive
+// Note: currentOffset is the offset of the first archived line within the current file and
+// archiveOffset is the offset it was written to within the archive
+func newRotation(currentOffset, archiveOffset int64) func(ref keyRef) (keyRef, bool) {
+	return func(ref keyRef) (keyRef, bool) {
+		if ref.archived {
+			return ref, true
+		}
+
+		if ref.offset < currentOffset {
+			// This reference was not archived, drop it
+			return ref, false
+		}
+
+		ref.archived = true
+		ref.offset = archiveOffset + (ref.offset - currentOffset)
+		return ref, true
+	}
+}
+
+// newSegmentRotation will wrap a remap func so newly archived references point within the segment at segmentOffset
+func newSegmentRotation(fn func(ref keyRef) (keyRef, bool), segmentOffset int64) func(ref keyRef) (keyRef, bool) {
+	return func(ref keyRef) (keyRef, bool) {
+		if ref.archived {
+			return ref, true
+		}
+
+		ref, ok := fn(ref)
+		if !ok {
+			return ref, false
+		}
+
+		ref.segmented = true
+		ref.inner = ref.offset
+		ref.offset = segmentOffset
+		return ref, true
+	}
+}
+
+// remap will update the location of each reference, references are dropped when fn returns false
+func (k *keyIndex) remap(fn func(ref keyRef) (keyRef, bool)) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if !k.enabled {
+		return
+	}
+
+	for key, refs := range k.refs {
+		remapped := refs[:0]
+		for _, ref := range refs {
+			var ok bool
+			if ref, ok = fn(ref); ok {
+				remapped = append(remapped, ref)
+			}
+		}
+
+		if len(remapped) == 0 {
+			delete(k.refs, key)
+			continue
+		}
+
+		k.refs[key] = remapped
+	}
+}
+
+// drop will remove the current file references at or beyond offset, used when a write is rolled back
+func (k *keyIndex) drop(offset int64) {
+	k.remap(func(ref keyRef) (keyRef, bool) {
+		return ref, ref.archived || ref.offset < offset
+	})
+}
+
+// get will return a copy of the references for a given key within a bucket
+func (k *keyIndex) get(bucket, key []byte) (refs []keyRef) {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	return append(refs, k.refs[indexKey(bucket, key)]...)
+}
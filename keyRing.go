@@ -0,0 +1,170 @@
+package mrT
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/itsmontoya/middleware"
+)
+
+// NewKeyRing will return a new key ring
+func NewKeyRing() *KeyRing {
+	var k KeyRing
+	k.keys = make(map[string]middleware.Middleware)
+	return &k
+}
+
+// KeyRing is a versioned set of encryption middlewares, each put and delete references the key id it was written with
+// Note: New writes will always use the active key, older keys are only used for reading
+type KeyRing struct {
+	mux sync.RWMutex
+	// Middlewares by key id
+	keys map[string]middleware.Middleware
+	// Active key id
+	active string
+}
+
+// Add will add a key to the key ring
+// Note: If this is the first key added, it will be set as the active key
+func (k *KeyRing) Add(keyID string, mw middleware.Middleware) (err error) {
+	if keyID == "" || mw == nil {
+		return ErrInvalidKey
+	}
+
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	k.keys[keyID] = mw
+	if k.active == "" {
+		k.active = keyID
+	}
+
+	return
+}
+
+// Remove will remove a key from the key ring
+// Note: Lines written with this key will no longer be readable, call Rekey beforehand
+func (k *KeyRing) Remove(keyID string) (err error) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if keyID == k.active {
+		return ErrActiveKey
+	}
+
+	if _, ok := k.keys[keyID]; !ok {
+		return ErrKeyNotInRing
+	}
+
+	delete(k.keys, keyID)
+	return
+}
+
+// SetActive will set the key used for new writes
+func (k *KeyRing) SetActive(keyID string) (err error) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if _, ok := k.keys[keyID]; !ok {
+		return ErrKeyNotInRing
+	}
+
+	k.active = keyID
+	return
+}
+
+// Active will return the active key id
+func (k *KeyRing) Active() (keyID string) {
+	k.mux.RLock()
+	keyID = k.active
+	k.mux.RUnlock()
+	return
+}
+
+func (k *KeyRing) get(keyID string) (mw middleware.Middleware, err error) {
+	var ok bool
+	k.mux.RLock()
+	mw, ok = k.keys[keyID]
+	k.mux.RUnlock()
+
+	if !ok {
+		err = ErrKeyNotInRing
+	}
+
+	return
+}
+
+// newRekeyer will return a new rekeyer, readOffset and writeOffset are the starting offsets of the source and destination
+func newRekeyer(m *MrT, w io.Writer, readOffset, writeOffset int64) *rekeyer {
+	var r rekeyer
+	r.m = m
+	r.w = w
+	r.roff = readOffset
+	r.woff = writeOffset
+
+	if m.idx.isEnabled() {
+		// Line offsets are only tracked when they are needed to update the key index
+		r.offsets = make(map[int64]int64)
+	}
+
+	return &r
+}
+
+// rekeyer will copy lines, re-encoding any put or delete which was not written with the active key
+type rekeyer struct {
+	m *MrT
+	w io.Writer
+
+	// Read offset
+	roff int64
+	// Write offset
+	woff int64
+	// New offsets of each copied line, by their original offset
+	offsets map[int64]int64
+}
+
+func (r *rekeyer) copy(src io.Reader) (err error) {
+	br := bufio.NewReader(src)
+	for {
+		var line []byte
+		if line, err = br.ReadBytes('\n'); err == io.EOF {
+			// Partial lines are left for the next copy
+			return nil
+		} else if err != nil {
+			return
+		}
+
+		if r.offsets != nil {
+			r.offsets[r.roff] = r.woff
+		}
+
+		r.roff += int64(len(line))
+
+		if err = r.m.lbuf.Update(func(buf *bytes.Buffer) (err error) {
+			if err = r.m.rekeyLine(buf, line); err != nil {
+				return
+			}
+
+			_, err = r.w.Write(buf.Bytes())
+			r.woff += int64(buf.Len())
+			return
+		}); err != nil {
+			return
+		}
+	}
+}
+
+// remap will update a key index reference to the line's new location
+func (r *rekeyer) remap(ref keyRef, archived bool) (keyRef, bool) {
+	if ref.archived != archived {
+		return ref, true
+	}
+
+	offset, ok := r.offsets[ref.offset]
+	if !ok {
+		return ref, false
+	}
+
+	ref.archived = true
+	ref.offset = offset
+	return ref, true
+}
@@ -0,0 +1,17 @@
+package mrT
+
+// Logger is notified of recoverable anomalies, such as rolled back writes, removed corrupt records, archive
+// rotations and import conflicts
+// Note: Arguments are alternating key/value pairs, a *slog.Logger (log/slog) satisfies Logger
+type Logger interface {
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// nopLogger discards everything, used when no logger is set
+type nopLogger struct{}
+
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
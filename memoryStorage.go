@@ -0,0 +1,272 @@
+package mrT
+
+import (
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+)
+
+// NewMemoryStorage will return a new in-memory storage
+// Note: Files only live as long as the storage, the same storage must be provided to re-open a database
+func NewMemoryStorage() *MemoryStorage {
+	var m MemoryStorage
+	m.files = make(map[string]*memoryData)
+	m.locks = make(map[string]struct{})
+	return &m
+}
+
+// MemoryStorage stores files in memory
+type MemoryStorage struct {
+	mux   sync.Mutex
+	files map[string]*memoryData
+	// Names currently locked
+	locks map[string]struct{}
+	// Number of temporary files created, used for naming
+	tmps int
+}
+
+// MkdirAll will create a directory along with any missing parents
+// Note: Directories are implicit within memory storage
+func (m *MemoryStorage) MkdirAll(dir string) error {
+	return nil
+}
+
+// Open will open a file for reading and writing, the file is created when it does not exist
+func (m *MemoryStorage) Open(name string) (f File, err error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	name = path.Clean(name)
+
+	d, ok := m.files[name]
+	if !ok {
+		d = &memoryData{}
+		m.files[name] = d
+	}
+
+	return newMemoryFile(d), nil
+}
+
+// OpenReadOnly will open an existing file for reading, writes to the file will fail
+func (m *MemoryStorage) OpenReadOnly(name string) (f File, err error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	name = path.Clean(name)
+
+	d, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	mf := newMemoryFile(d)
+	mf.readOnly = true
+	return mf, nil
+}
+
+// TempFile will create a new temporary file
+func (m *MemoryStorage) TempFile() (f File, name string, err error) {
+	m.mux.Lock()
+	m.tmps++
+	name = path.Join("/tmp", "mrT"+strconv.Itoa(m.tmps))
+	m.mux.Unlock()
+
+	f, err = m.Open(name)
+	return
+}
+
+// Rename will atomically replace newName with oldName
+// Note: Handles opened before the rename will continue to reference the previous contents of newName
+func (m *MemoryStorage) Rename(oldName, newName string) (err error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	oldName = path.Clean(oldName)
+
+	d, ok := m.files[oldName]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: os.ErrNotExist}
+	}
+
+	delete(m.files, oldName)
+	m.files[path.Clean(newName)] = d
+	return
+}
+
+// Remove will remove a file
+func (m *MemoryStorage) Remove(name string) (err error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	name = path.Clean(name)
+
+	if _, ok := m.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+
+	delete(m.files, name)
+	return
+}
+
+// Lock will acquire an exclusive lock for name
+func (m *MemoryStorage) Lock(name string) (l io.Closer, err error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	name = path.Clean(name)
+
+	if _, ok := m.locks[name]; ok {
+		return nil, ErrLocked
+	}
+
+	m.locks[name] = struct{}{}
+	return &memoryLock{m: m, name: name}, nil
+}
+
+// memoryLock is a held memory storage lock
+type memoryLock struct {
+	m    *MemoryStorage
+	name string
+	once sync.Once
+}
+
+// Close will release the lock
+func (l *memoryLock) Close() error {
+	l.once.Do(func() {
+		l.m.mux.Lock()
+		delete(l.m.locks, l.name)
+		l.m.mux.Unlock()
+	})
+
+	return nil
+}
+
+// memoryData is the contents of a memory file, shared by all of it's handles
+type memoryData struct {
+	mux sync.RWMutex
+	b   []byte
+}
+
+func newMemoryFile(d *memoryData) *memoryFile {
+	var f memoryFile
+	f.d = d
+	return &f
+}
+
+// memoryFile is a handle to a memory file
+type memoryFile struct {
+	d   *memoryData
+	pos int64
+	// Whether or not writes are refused
+	readOnly bool
+}
+
+func (f *memoryFile) Read(b []byte) (n int, err error) {
+	n, err = f.ReadAt(b, f.pos)
+	f.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+
+	return
+}
+
+func (f *memoryFile) ReadAt(b []byte, offset int64) (n int, err error) {
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+
+	f.d.mux.RLock()
+	defer f.d.mux.RUnlock()
+
+	if offset >= int64(len(f.d.b)) {
+		return 0, io.EOF
+	}
+
+	if n = copy(b, f.d.b[offset:]); n < len(b) {
+		err = io.EOF
+	}
+
+	return
+}
+
+func (f *memoryFile) Write(b []byte) (n int, err error) {
+	if f.readOnly {
+		return 0, os.ErrPermission
+	}
+
+	f.d.mux.Lock()
+	defer f.d.mux.Unlock()
+
+	if end := f.pos + int64(len(b)); end > int64(len(f.d.b)) {
+		f.d.grow(end)
+	}
+
+	n = copy(f.d.b[f.pos:], b)
+	f.pos += int64(n)
+	return
+}
+
+func (f *memoryFile) Seek(offset int64, whence int) (pos int64, err error) {
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = f.pos + offset
+	case io.SeekEnd:
+		f.d.mux.RLock()
+		pos = int64(len(f.d.b)) + offset
+		f.d.mux.RUnlock()
+	default:
+		return 0, os.ErrInvalid
+	}
+
+	if pos < 0 {
+		return 0, os.ErrInvalid
+	}
+
+	f.pos = pos
+	return
+}
+
+func (f *memoryFile) Truncate(size int64) (err error) {
+	if size < 0 {
+		return os.ErrInvalid
+	} else if f.readOnly {
+		return os.ErrPermission
+	}
+
+	f.d.mux.Lock()
+	defer f.d.mux.Unlock()
+
+	if size > int64(len(f.d.b)) {
+		f.d.grow(size)
+		return
+	}
+
+	f.d.b = f.d.b[:size]
+	return
+}
+
+func (f *memoryFile) Sync() error {
+	return nil
+}
+
+func (f *memoryFile) Close() error {
+	return nil
+}
+
+// grow will extend the contents to the provided size, new bytes are zeroed
+// Note: The write lock must be held by the caller
+func (d *memoryData) grow(size int64) {
+	if size <= int64(cap(d.b)) {
+		n := len(d.b)
+		d.b = d.b[:size]
+		for i := n; i < len(d.b); i++ {
+			d.b[i] = 0
+		}
+
+		return
+	}
+
+	b := make([]byte, size, size*2)
+	copy(b, d.b)
+	d.b = b
+}
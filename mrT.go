@@ -1,15 +1,20 @@
 package mrT
 
 import (
+	"archive/tar"
 	"bytes"
+	"context"
 	"encoding/binary"
+	"encoding/json"
 	"io"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/PathDNA/atoms"
-	"github.com/PathDNA/cfile"
 	"github.com/PathDNA/fileutils/shasher"
 
 	"github.com/itsmontoya/middleware"
@@ -22,6 +27,7 @@ const (
 	// NilLine represents a zero-value for line types
 	NilLine byte = iota
 	// TransactionLine is a line with the transaction tag for the data lines following it
+	// Note: The value is the size of the transaction's data lines (as a decimal string), it is empty for older files
 	TransactionLine
 	// ReplayLine is a line which signals the replay through a transaction
 	ReplayLine
@@ -32,6 +38,22 @@ const (
 	PutLine
 	// DeleteLine is for removing data
 	DeleteLine
+	// BucketPutLine is for setting data within a bucket
+	BucketPutLine
+	// BucketDeleteLine is for removing data within a bucket
+	BucketDeleteLine
+	// HeaderLine is the metadata line written at the top of each file
+	// Note: This line type will always ignore middleware
+	HeaderLine
+	// SegmentLine is a compressed block of archived lines
+	// Note: This line type will always ignore middleware
+	SegmentLine
+	// newlineType is skipped as a line type, lines are delimited by newlines
+	newlineType
+	// TieredLine references a segment which has been moved to an object store, the key is the object key and
+	// the value is the segment's checksum
+	// Note: This line type will always ignore middleware
+	TieredLine
 )
 
 const (
@@ -41,6 +63,62 @@ const (
 	ErrNoTxn = errors.Error("no transactions available")
 	// ErrInvalidTxn is returned when an invalid transaction is provided
 	ErrInvalidTxn = errors.Error("transaction does not exist")
+	// ErrKeyNotFound is returned when a key does not exist at the requested point in time
+	ErrKeyNotFound = errors.Error("key not found")
+	// ErrInvalidBucket is returned when a bucket name is invalid
+	ErrInvalidBucket = errors.Error("invalid bucket name")
+	// ErrInvalidKey is returned when an invalid key ring key is provided
+	ErrInvalidKey = errors.Error("invalid key, key id and middleware are required")
+	// ErrKeyNotInRing is returned when a key id does not exist within the key ring
+	ErrKeyNotInRing = errors.Error("key id does not exist within key ring")
+	// ErrActiveKey is returned when attempting to remove the active key from a key ring
+	ErrActiveKey = errors.Error("cannot remove the active key")
+	// ErrNoKeyRing is returned when a key ring action is called on an instance without a key ring
+	ErrNoKeyRing = errors.Error("no key ring has been set")
+	// ErrUnknownMiddleware is returned when a policy selects a middleware which was not provided
+	ErrUnknownMiddleware = errors.Error("middleware does not exist")
+	// ErrTooManyMiddlewares is returned when more middlewares are provided than a policy can select from
+	ErrTooManyMiddlewares = errors.Error("policies cannot select from more than 8 middlewares")
+	// ErrInvalidSignature is returned when an export signature does not match it's payload
+	ErrInvalidSignature = errors.Error("invalid export signature")
+	// ErrUnsignedExport is returned when importing an unsigned export while verifiers are set
+	ErrUnsignedExport = errors.Error("export is not signed")
+	// ErrUnverifiedSignature is returned when importing a signed export while no verifiers are set
+	ErrUnverifiedSignature = errors.Error("export is signed, no verifiers have been set")
+	// ErrUnknownSigningKey is returned when an export was signed with a key id we cannot verify
+	ErrUnknownSigningKey = errors.Error("export was signed with an unknown key id")
+	// ErrSigningAlgorithm is returned when an export signing algorithm does not match the verifying key
+	ErrSigningAlgorithm = errors.Error("export signing algorithm does not match key")
+	// ErrTruncatedRecord is returned when a record is shorter than it's length prefixes declare
+	ErrTruncatedRecord = errors.Error("truncated record")
+	// ErrLengthOverflow is returned when a record length prefix exceeds the maximum size
+	ErrLengthOverflow = errors.Error("record length exceeds maximum size")
+	// ErrKeyTooLarge is returned when a key exceeds the maximum key size
+	ErrKeyTooLarge = errors.Error("key exceeds maximum size")
+	// ErrValueTooLarge is returned when a value exceeds the maximum value size
+	ErrValueTooLarge = errors.Error("value exceeds maximum size")
+	// ErrObjectNotFound is returned when an object does not exist within an object store
+	ErrObjectNotFound = errors.Error("object not found")
+	// ErrObjectChecksum is returned when a tiered segment does not match it's checksum
+	ErrObjectChecksum = errors.Error("object does not match it's checksum")
+	// ErrNoObjectStore is returned when reading a tiered segment without an object store
+	ErrNoObjectStore = errors.Error("archive contains tiered segments but no object store is set")
+	// ErrInvalidS3Opts is returned when an S3 object store is missing it's endpoint or bucket
+	ErrInvalidS3Opts = errors.Error("s3 object store requires an endpoint and bucket")
+	// ErrLocked is returned when opening a database which another writer has open
+	ErrLocked = errors.Error("database is locked by another writer")
+	// ErrReadOnly is returned when writing to a database which was opened read-only
+	ErrReadOnly = errors.Error("database is open in read-only mode")
+	// ErrFailed is returned when writing after a partial write could not be rolled back
+	ErrFailed = errors.Error("a partial write could not be rolled back, the database must be recovered")
+	// ErrInvalidBackup is returned when a backup is malformed or does not match it's manifest
+	ErrInvalidBackup = errors.Error("invalid backup")
+	// ErrRestoreExists is returned when attempting to restore over an existing database
+	ErrRestoreExists = errors.Error("cannot restore over an existing database")
+	// ErrNoBackupChain is returned when a backup chain does not exist within a directory
+	ErrNoBackupChain = errors.Error("backup chain does not exist")
+	// ErrBrokenChain is returned when a backup chain is missing a link or does not match it's manifest
+	ErrBrokenChain = errors.Error("backup chain is broken")
 )
 
 var (
@@ -49,23 +127,47 @@ var (
 
 // New will return a new instance of MrT
 func New(dir, name string, mws ...middleware.Middleware) (mp *MrT, err error) {
+	var opts Opts
+	opts.Middlewares = mws
+	return NewWithOpts(dir, name, opts)
+}
+
+// NewWithOpts will return a new instance of MrT with the provided options
+func NewWithOpts(dir, name string, opts Opts) (mp *MrT, err error) {
 	var mrT MrT
-	// Make the dirs needed for file
-	if err = os.MkdirAll(path.Join(dir, "archive"), 0755); err != nil {
+	if opts.Policy != nil && len(opts.Middlewares) > 8 {
+		err = ErrTooManyMiddlewares
 		return
 	}
 
-	if mrT.f, err = cfile.New(path.Join(dir, name+".tdb"), 0644); err != nil {
-		return
-	}
+	mrT.fs = getStorage(opts)
+
+	defer func() {
+		if err != nil {
+			// Release everything we have opened so far
+			mrT.close()
+		}
+	}()
+
+	if mrT.readOnly = opts.ReadOnly; !mrT.readOnly {
+		// Make the dirs needed for file
+		if err = mrT.fs.MkdirAll(path.Join(dir, "archive")); err != nil {
+			return
+		}
 
-	mrT.f.SyncAfterWriterClose = true
+		// Acquire the writer lock, only one writer may have the database open at a time
+		if mrT.lock, err = mrT.fs.Lock(path.Join(dir, name+".lock")); err != nil {
+			return
+		}
+	}
 
-	if mrT.af, err = cfile.New(path.Join(dir, "archive", name+".tdb"), 0644); err != nil {
+	if mrT.f, err = newLockedFile(mrT.fs, path.Join(dir, name+".tdb"), mrT.readOnly); err != nil {
 		return
 	}
 
-	mrT.af.SyncAfterWriterClose = true
+	if mrT.af, err = newLockedFile(mrT.fs, path.Join(dir, "archive", name+".tdb"), mrT.readOnly); err != nil {
+		return
+	}
 
 	mrT.dir = dir
 	mrT.name = name
@@ -76,13 +178,90 @@ func New(dir, name string, mws ...middleware.Middleware) (mp *MrT, err error) {
 	// Create new seeker
 	//	mrT.s = seeker.New(mrT.f)
 	// Set Mr.T's middleware
-	mrT.setMWs(mws)
-	// Set last transaction
-	mrT.setLastTxn()
+	mrT.setMWs(opts.Middlewares)
+	mrT.kr = opts.KeyRing
+	mrT.policy = opts.Policy
+	mrT.compressArchive = opts.CompressArchive || opts.ObjectStore != nil
+	if opts.ObjectStore != nil {
+		mrT.tier = newTier(opts.ObjectStore)
+	}
+
+	mrT.obs = opts.Observer
+	if mrT.log = opts.Logger; mrT.log == nil {
+		mrT.log = nopLogger{}
+	}
+
+	mrT.lim = newSizeLimits(opts.MaxKeySize, opts.MaxValueSize)
+	mrT.setSigning(opts.Signer, opts.Verifiers)
+	// Write or validate our file headers
+	if err = mrT.initHeaders(); err != nil {
+		return
+	}
+
+	if mrT.readOnly {
+		// Pick up the current state of the writer's files
+		err = mrT.follow()
+	} else {
+		// Set last transaction
+		err = mrT.setLastTxn()
+	}
+
+	if err != nil {
+		return
+	}
+
 	mp = &mrT
 	return
 }
 
+// OpenReadOnly will open an existing database without writing to it, writes will return ErrReadOnly
+// Note: Changes made by the database's writer (even within another process) are picked up by each read
+func OpenReadOnly(dir, name string, opts Opts) (mp *MrT, err error) {
+	opts.ReadOnly = true
+	return NewWithOpts(dir, name, opts)
+}
+
+// Opts are the options used when opening MrT
+type Opts struct {
+	// Middlewares applied to each put and delete
+	Middlewares []middleware.Middleware
+	// KeyRing (optional) will apply versioned encryption to each put and delete
+	// Note: Key ring middlewares are applied after the standard middlewares
+	KeyRing *KeyRing
+	// Policy (optional) will select which middlewares apply to each put and delete
+	// Note: Policies can select from a maximum of 8 middlewares
+	Policy PolicyFn
+	// MaxKeySize is the maximum size of a key, DefaultMaxKeySize is used when unset
+	MaxKeySize int
+	// MaxValueSize is the maximum size of a value, DefaultMaxValueSize is used when unset
+	MaxValueSize int
+	// CompressArchive will compress each block of archived lines into a single segment line
+	// Note: Segments are compressed using the dictionary stored within the file header (if one exists)
+	CompressArchive bool
+	// Signer (optional) will sign exports
+	Signer Signer
+	// Verifiers (optional) are the keys exports are verified with, when set imports must be signed
+	Verifiers []Verifier
+	// Storage (optional) will store the current file, archive and temporary files
+	// Note: The operating system is used when unset
+	Storage Storage
+	// ObjectStore (optional) will store archived segments, the archive file will only contain references to them
+	// Note: Setting an object store implies CompressArchive
+	ObjectStore ObjectStore
+	// ReadOnly will open the database without acquiring the writer lock or writing to it, see OpenReadOnly
+	// Note: Writers acquire an exclusive lock and a second writer is refused with ErrLocked. When using the operating
+	// system storage, the lock is only enforced on unix platforms (linux, darwin and the BSDs). Elsewhere no lock is
+	// taken and the caller must ensure only a single writer opens the database
+	ReadOnly bool
+	// Observer (optional) will be notified of each transaction, sync, archive, export, import and filter
+	Observer Observer
+	// Logger (optional) will be notified of recoverable anomalies, nothing is logged when unset
+	Logger Logger
+}
+
+// PolicyFn is used to select the middlewares (by name) which apply to a put or delete
+type PolicyFn func(key, value []byte) (mws []string)
+
 // MrT is Mister Transaction, he manages file transactions
 // He also pities a fool
 type MrT struct {
@@ -91,17 +270,56 @@ type MrT struct {
 	// Copy on read
 	cor bool
 
+	// Storage for our files
+	fs Storage
+	// Writer lock, nil when read-only
+	lock io.Closer
+	// Whether or not writes are refused
+	readOnly bool
+	// State of our files when last followed, only used when read-only
+	fol    followState
+	folMux sync.Mutex
 	// Current file
-	f *cfile.File
+	f *lockedFile
 	// Archive file
-	af *cfile.File
-
-	ug *uuid.Gen
-	mw *middleware.MWs
+	af *lockedFile
+
+	ug  *uuid.Gen
+	mws []middleware.Middleware
+	mw  *middleware.MWs
+	kr  *KeyRing
+	// Middleware names, index aligned with mws
+	mwNames []string
+	policy  PolicyFn
+	// Whether or not archived lines are compressed into segments
+	compressArchive bool
+	// Object store tier for archived segments
+	tier *tier
+	// Maximum key and value sizes
+	lim sizeLimits
+	// Observer of our operations
+	obs Observer
+	// Logger of recoverable anomalies
+	log Logger
+	// Export signer
+	signer Signer
+	// Import verifiers by key id
+	verifiers map[string]Verifier
 
 	lbuf lbuf
 	nbuf [8]byte
 	ltxn atoms.String
+	// File header
+	hdr Header
+	// Optional key index
+	idx keyIndex
+	// Counts reported by Stats
+	stats fileStats
+	// Commit hooks
+	hooks hooks
+
+	// Whether or not a partial write could not be rolled back, writes are refused until recovered
+	failed atoms.Bool
 
 	closed atoms.Bool
 }
@@ -111,14 +329,188 @@ func (m *MrT) setMWs(mws []middleware.Middleware) {
 		return
 	}
 
+	m.mws = mws
 	m.mw = middleware.NewMWs(mws...)
+	m.mwNames = m.mw.List()
+	return
+}
+
+func (m *MrT) setSigning(s Signer, vs []Verifier) {
+	m.signer = s
+	if len(vs) == 0 {
+		return
+	}
+
+	m.verifiers = make(map[string]Verifier, len(vs))
+	for _, v := range vs {
+		m.verifiers[v.KeyID()] = v
+	}
+}
+
+// getFlags will return the middleware flags selected by our policy
+func (m *MrT) getFlags(key, value []byte) (flags byte, err error) {
+	for _, name := range m.policy(key, value) {
+		var found bool
+		for i, mwName := range m.mwNames {
+			if mwName != name {
+				continue
+			}
+
+			flags |= 1 << uint(i)
+			found = true
+			break
+		}
+
+		if !found {
+			return 0, ErrUnknownMiddleware
+		}
+	}
+
+	return
+}
+
+// getChain will return the middlewares for a record
+// Note: Flags are only used when a policy is set and the key id is only used when a key ring is set
+func (m *MrT) getChain(flags byte, keyID string) (mws *middleware.MWs, err error) {
+	if m.policy == nil && m.kr == nil {
+		return m.mw, nil
+	}
+
+	var chain []middleware.Middleware
+	for i, mw := range m.mws {
+		if m.policy != nil && flags&(1<<uint(i)) == 0 {
+			continue
+		}
+
+		chain = append(chain, mw)
+	}
+
+	if m.kr != nil {
+		var mw middleware.Middleware
+		if mw, err = m.kr.get(keyID); err != nil {
+			return
+		}
+
+		chain = append(chain, mw)
+	}
+
+	if len(chain) == 0 {
+		return
+	}
+
+	mws = middleware.NewMWs(chain...)
+	return
+}
+
+// splitRecord will split a put or delete payload into it's record header and middleware payload
+func (m *MrT) splitRecord(b []byte) (flags byte, keyID string, payload []byte, err error) {
+	payload = b
+	if m.policy != nil {
+		if len(payload) == 0 {
+			err = ErrInvalidLine
+			return
+		}
+
+		flags = payload[0]
+		payload = payload[1:]
+	}
+
+	if m.kr != nil {
+		var kb []byte
+		if kb, payload, err = splitField(payload); err != nil {
+			return
+		}
+
+		keyID = string(kb)
+	}
+
+	return
+}
+
+func (m *MrT) initHeaders() (err error) {
+	var mws []string
+	if m.mw != nil {
+		mws = m.mw.List()
+	}
+
+	m.hdr = newHeader(m.name, mws, m.kr != nil, m.policy != nil)
+	m.hdr.Dictionary = getDictionary(m.mws)
+	if err = m.initHeader(m.f); err != nil {
+		return
+	}
+
+	if err = m.initHeader(m.af); m.readOnly && os.IsNotExist(err) {
+		// The writer has not archived yet
+		err = nil
+	}
+
 	return
 }
 
+// initHeader will write the header to an empty file or validate the header of an existing file
+func (m *MrT) initHeader(lf *lockedFile) (err error) {
+	return lf.With(func(f File) (err error) {
+		var size int64
+		if size, err = f.Seek(0, io.SeekEnd); err != nil {
+			return
+		}
+
+		if size == 0 && m.readOnly {
+			// The writer has not initialized this file yet
+			return
+		} else if size == 0 {
+			return m.lbuf.Update(func(buf *bytes.Buffer) (err error) {
+				if err = m.writeHeader(buf); err != nil {
+					return
+				}
+
+				if _, err = f.Write(buf.Bytes()); err != nil {
+					return
+				}
+
+				return f.Sync()
+			})
+		}
+
+		var hdr *Header
+		if hdr, err = readHeader(f); err != nil || hdr == nil {
+			// Files created before headers existed have nothing to validate
+			return
+		}
+
+		if err = m.hdr.validate(hdr); err != nil {
+			return
+		}
+
+		// Retain the original creation time
+		m.hdr.Created = hdr.Created
+		// Adopt the stored dictionary when one was not provided
+		m.setDictionary(hdr.Dictionary)
+		return
+	})
+}
+
+func (m *MrT) writeHeader(buf *bytes.Buffer) (err error) {
+	var b []byte
+	if b, err = json.Marshal(&m.hdr); err != nil {
+		return
+	}
+
+	return m.writeLine(buf, HeaderLine, headerKey, b)
+}
+
 func (m *MrT) setLastTxn() (err error) {
-	// Set last transaction
-	return m.ForEach("", false, func(lt byte, key, val []byte) (err error) {
-		if lt != TransactionLine && lt != ReplayLine {
+	rdr := m.reader()
+	defer rdr.Close()
+
+	// Only transaction and replay lines are read, the actions are not decoded
+	return forEachLine(rdr, 0, func(line []byte, _ int64) (err error) {
+		if len(line) == 0 || (line[0] != TransactionLine && line[0] != ReplayLine) {
+			return
+		}
+
+		var key []byte
+		if key, _, err = getKV(line[1:]); err != nil {
 			return
 		}
 
@@ -128,28 +520,98 @@ func (m *MrT) setLastTxn() (err error) {
 }
 
 func (m *MrT) isMWWrite(lineType byte) bool {
-	if m.mw == nil {
+	if m.mw == nil && m.kr == nil && m.policy == nil {
 		return false
 	}
 
-	return lineType == PutLine || lineType == DeleteLine
+	return isActionLine(lineType)
 }
 
 func (m *MrT) writeLine(buf *bytes.Buffer, lineType byte, key, value []byte) (err error) {
+	if isActionLine(lineType) {
+		if err = m.lim.check(key, value); err != nil {
+			return
+		}
+	}
+
+	// Write line type
+	buf.WriteByte(lineType)
+
+	if err = m.writePayload(buf, lineType, key, value); err != nil {
+		return
+	}
+
+	buf.WriteByte('\n')
+	return
+}
+
+// writeTxnLine will write a transaction line for the actions within buf, the line is moved ahead of the actions
+func (m *MrT) writeTxnLine(buf *bytes.Buffer, txnID string) (err error) {
+	size := buf.Len()
+	if err = m.writeLine(buf, TransactionLine, []byte(txnID), []byte(strconv.Itoa(size))); err != nil {
+		return
+	}
+
+	b := buf.Bytes()
+	line := append([]byte(nil), b[size:]...)
+	copy(b[len(line):], b[:size])
+	copy(b, line)
+	return
+}
+
+func (m *MrT) writeBucketLine(buf *bytes.Buffer, lineType byte, bucket, key, value []byte) (err error) {
+	if err = m.lim.check(key, value); err != nil {
+		return
+	}
+
 	// Write line type
 	buf.WriteByte(lineType)
 
+	// Bucket is always written raw so lines can be filtered by bucket without decoding
+	m.writeBytes(buf, bucket)
+
+	if err = m.writePayload(buf, lineType, key, value); err != nil {
+		return
+	}
+
+	buf.WriteByte('\n')
+	return
+}
+
+func (m *MrT) writePayload(buf *bytes.Buffer, lineType byte, key, value []byte) (err error) {
 	// If this is not a middleware write, use fast-path
 	if !m.isMWWrite(lineType) {
-		m.writeRawBytes(buf, key, value)
-	} else {
-		if err = m.writeMWBytes(buf, key, value); err != nil {
+		return m.writeRawBytes(buf, key, value)
+	}
+
+	var flags byte
+	if m.policy != nil {
+		if flags, err = m.getFlags(key, value); err != nil {
 			return
 		}
+
+		// Flags are written raw so the line can be decoded with the proper middlewares
+		buf.WriteByte(flags)
 	}
 
-	buf.WriteByte('\n')
-	return
+	var keyID string
+	if m.kr != nil {
+		keyID = m.kr.Active()
+		// Key id is written raw so the line can be decoded with the proper key
+		m.writeBytes(buf, []byte(keyID))
+	}
+
+	var mws *middleware.MWs
+	if mws, err = m.getChain(flags, keyID); err != nil {
+		return
+	}
+
+	if mws == nil {
+		// No middlewares were selected for this line
+		return m.writeRawBytes(buf, key, value)
+	}
+
+	return m.writeMWBytes(buf, mws, key, value)
 }
 
 func (m *MrT) writeRawBytes(buf *bytes.Buffer, key, value []byte) (err error) {
@@ -159,9 +621,9 @@ func (m *MrT) writeRawBytes(buf *bytes.Buffer, key, value []byte) (err error) {
 	return
 }
 
-func (m *MrT) writeMWBytes(buf *bytes.Buffer, key, value []byte) (err error) {
+func (m *MrT) writeMWBytes(buf *bytes.Buffer, mws *middleware.MWs, key, value []byte) (err error) {
 	var w *middleware.Writer
-	if w, err = m.mw.Writer(buf); err != nil {
+	if w, err = mws.Writer(buf); err != nil {
 		return
 	}
 	defer w.Close()
@@ -191,15 +653,24 @@ func (m *MrT) writeBytes(w io.Writer, b []byte) (err error) {
 }
 
 // isInCurrent will return whether or not a transaction id is within the current file
+// Note: Callers already holding a reader of the current file must use isInFile, a second read lock would block
+// behind a waiting writer
 func (m *MrT) isInCurrent(txnID string) (ok bool) {
+	rdr := m.reader()
+	defer rdr.Close()
+	return isInFile(rdr, txnID)
+}
+
+// isInFile will return whether or not a transaction id is within the provided current file
+// Note: The file is reset to it's start before returning
+func isInFile(r io.ReadSeeker, txnID string) (ok bool) {
 	var err error
 	if txnID == "" {
 		return true
 	}
 
-	rdr := m.f.Reader()
-	defer rdr.Close()
-	s := seeker.New(rdr)
+	defer r.Seek(0, io.SeekStart)
+	s := seeker.New(r)
 
 	var rtid string
 	rtid, err = replayID(s)
@@ -224,404 +695,1749 @@ func (m *MrT) isInCurrent(txnID string) (ok bool) {
 	return ru.Time().UnixNano() >= pu.Time().UnixNano()
 }
 
-func (m *MrT) readArchiveLines(fn func(*bytes.Buffer) error) (err error) {
-	ar := m.af.Reader()
-	defer ar.Close()
-	as := seeker.New(ar)
-	return as.ReadLines(fn)
-}
+// isTimeInCurrent will return whether or not a timestamp is covered by the current file
+func (m *MrT) isTimeInCurrent(ts time.Time) (ok bool) {
+	rdr := m.reader()
+	defer rdr.Close()
+	s := seeker.New(rdr)
 
-func (m *MrT) getToken() (token []byte) {
-	token = []byte(m.name)
-	if m.mw != nil {
-		token = append(token, strings.Join(m.mw.List(), ",")...)
+	rtid, err := replayID(s)
+	if err != nil || rtid == "" {
+		// Our file has never been archived (or was empty when archived), all transactions are within the current file
+		return true
 	}
 
-	return
+	// The replay id is the last archived transaction, everything after it is within the current file
+	var rts time.Time
+	if rts, err = getTxnTime(rtid); err != nil {
+		return
+	}
+
+	return ts.After(rts)
 }
 
-func (m *MrT) newTxnID() string {
-	return m.ug.New().String()
+func (m *MrT) readArchiveLines(fn func(*bytes.Buffer) error) (err error) {
+	ar := m.archiveReader()
+	defer ar.Close()
+	as := seeker.New(ar)
+	return as.ReadLines(m.expandSegments(fn))
 }
 
-// filter will iterate through filtered lines
-func (m *MrT) filter(txnID string, archive bool, fn FilterFn, filters []Filter) (err error) {
-	f := newFilter(fn, filters)
-	curR := m.f.Reader()
-	defer curR.Close()
-	s := seeker.New(curR)
+// readLines will read the lines of the archive (when requested) followed by the lines of the current file
+// Note: ErrEndEarly only ends the reading of the file currently being read
+func (m *MrT) readLines(archive bool, fn func(*bytes.Buffer) error) (err error) {
+	rdr := m.reader()
+	defer rdr.Close()
 
-	if archive && !m.isInCurrent(txnID) {
-		if err = m.readArchiveLines(f.processLine); err == nil {
-			if _, err = nextTxn(s); err == ErrNoTxn {
-				// We do not have any new transactions after our replay id, no need to read from current
-				return nil
-			} else if err != nil {
-				return
-			}
-		} else if os.IsNotExist(err) {
-			// No archive exists, we can still pull from current though
-			err = nil
-		} else {
+	if archive {
+		if err = m.readArchiveLines(fn); err != nil && !os.IsNotExist(err) {
 			return
 		}
 	}
 
-	if err = s.ReadLines(f.processLine); err != nil && os.IsNotExist(err) {
+	s := seeker.New(rdr)
+	if err = s.ReadLines(fn); os.IsNotExist(err) {
 		err = nil
 	}
 
 	return
 }
 
-func (m *MrT) processLine(buf *bytes.Buffer) (lineType byte, key, value []byte, err error) {
-	if lineType, err = buf.ReadByte(); err != nil {
-		// Error encountered getting line type
+// buildState will reconstruct the state of a bucket as of the provided transaction id
+// Note: If bucket is empty, the keys outside of buckets are reconstructed. If key is nil, the state of the entire
+// keyspace will be reconstructed
+func (m *MrT) buildState(txnID, bucket string, key []byte) (sb *stateBuilder, err error) {
+	if m.closed.Get() {
+		err = errors.ErrIsClosed
 		return
 	}
 
-	switch lineType {
-	case TransactionLine:
-		key, value = getKV(buf.Bytes())
-
-	case CommentLine, ReplayLine:
-		key, value = getKV(buf.Bytes())
-
-	case PutLine, DeleteLine:
-		key, value, err = getProcessedKV(buf, m.mw, m.cor)
-
-	default:
-		err = ErrInvalidLine
-	}
-
-	return
-}
-
-func (m *MrT) parseImportPayload(w *os.File, r io.Reader) (err error) {
-	var (
-		tmpF *os.File
-		tmpN string
-	)
-
-	if tmpF, tmpN, err = getTmp(); err != nil {
+	if err = m.follow(); err != nil {
 		return
 	}
-	defer os.RemoveAll(tmpN)
-	defer tmpF.Close()
 
-	if _, err = io.Copy(tmpF, r); err != nil {
-		return
+	sb = newStateBuilder(m, txnID, bucket, key)
+
+	// The replay block at the top of the current file is our checkpoint, we only
+	// need to replay the archive when the transaction predates it
+	if m.isInCurrent(txnID) {
+		err = m.readLines(false, sb.processLine)
+	} else if err = m.readArchiveLines(sb.processLine); os.IsNotExist(err) {
+		err = nil
 	}
 
-	if _, err = tmpF.Seek(0, io.SeekStart); err != nil {
+	if err != nil {
 		return
 	}
 
-	// Parse payload, check for proper token and signature
-	if _, _, err = shasher.ParseWithToken(m.getToken(), tmpF, w); err != nil {
-		return
+	if !sb.matched {
+		err = ErrInvalidTxn
 	}
 
-	_, err = w.Seek(0, io.SeekStart)
 	return
 }
 
-func (m *MrT) appendImportPayload(f *os.File) (err error) {
-	// Acquire an appender
-	a := m.f.Appender()
-	defer a.Close()
-	// Copy payload to appender
-	if _, err = io.Copy(a, f); err != nil {
-		return
-	}
-	// Reset position before being used again
-	_, err = f.Seek(0, io.SeekStart)
-	return
+// currentSize will return the size of the current file
+// Note: The caller must hold the current file
+func (m *MrT) currentSize() (size int64, err error) {
+	return m.f.size()
 }
 
-func (m *MrT) exportArchive(e *exporter) (err error) {
-	rdr := m.af.Reader()
-	defer rdr.Close()
+func (m *MrT) scanKeyHistory(bucket string, key []byte, fn KeyHistoryFn) (err error) {
+	var ti *TxnInfo
+	return m.readLines(true, func(buf *bytes.Buffer) (err error) {
+		var (
+			lineType byte
+			k, v     []byte
+			b        []byte
+		)
 
-	err = e.exportFrom(rdr)
-	switch {
-	case err == ErrNoTxn:
-		err = ErrInvalidTxn
-	case os.IsNotExist(err):
-		err = nil
-	}
+		line := buf.Bytes()
+		if lineType, k, v, err = m.processLine(buf); err != nil {
+			return
+		}
+
+		switch lineType {
+		case TransactionLine:
+			ti, err = newTxnInfo(string(k))
+		case ReplayLine:
+			// Replay blocks are snapshots rather than changes, ignore the actions within
+			ti = nil
+		case PutLine, DeleteLine, BucketPutLine, BucketDeleteLine:
+			if ti == nil || !bytes.Equal(key, k) {
+				return
+			}
+
+			if b, err = lineBucket(line); err != nil || string(b) != bucket {
+				return
+			}
+
+			ai := newActionInfo(lineType == PutLine || lineType == BucketPutLine, k, v)
+			ai.Bucket = bucket
+			err = fn(ti, ai)
+		}
+
+		return
+	})
+}
+
+func (m *MrT) indexedKeyHistory(bucket string, key []byte, fn KeyHistoryFn) (err error) {
+	// Acquire our readers before getting our references to ensure they aren't rotated from underneath us
+	rdr := m.reader()
+	defer rdr.Close()
+	ar := m.archiveReader()
+	defer ar.Close()
+
+	var ti *TxnInfo
+	for _, ref := range m.idx.get([]byte(bucket), key) {
+		var buf *bytes.Buffer
+		if ref.segmented {
+			buf, err = m.readSegmentLineAt(ar, ref.offset, ref.inner)
+		} else if ref.archived {
+			buf, err = readLineAt(ar, ref.offset)
+		} else {
+			buf, err = readLineAt(rdr, ref.offset)
+		}
+
+		if err != nil {
+			return
+		}
+
+		var (
+			lineType byte
+			k, v     []byte
+		)
+
+		if lineType, k, v, err = m.processLine(buf); err != nil {
+			return
+		}
+
+		if ti == nil || ti.ID != ref.txnID {
+			if ti, err = newTxnInfo(ref.txnID); err != nil {
+				return
+			}
+		}
+
+		ai := newActionInfo(lineType == PutLine || lineType == BucketPutLine, k, v)
+		ai.Bucket = bucket
+		if err = fn(ti, ai); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (m *MrT) getToken() (token []byte) {
+	token = []byte(m.name)
+	if m.mw != nil {
+		token = append(token, strings.Join(m.mw.List(), ",")...)
+	}
+
+	if m.kr != nil {
+		token = append(token, ",keyRing"...)
+	}
+
+	if m.policy != nil {
+		token = append(token, ",policy"...)
+	}
+
+	return
+}
+
+// decodeKV will decode the key and value of a put or delete payload
+func (m *MrT) decodeKV(buf *bytes.Buffer, cor bool) (key, value []byte, err error) {
+	if m.policy == nil && m.kr == nil {
+		return getProcessedKV(buf, m.mw, cor, m.lim)
+	}
+
+	var (
+		flags   byte
+		keyID   string
+		payload []byte
+	)
+
+	if flags, keyID, payload, err = m.splitRecord(buf.Bytes()); err != nil {
+		return
+	}
+
+	var mws *middleware.MWs
+	if mws, err = m.getChain(flags, keyID); err != nil {
+		return
+	}
+
+	return getProcessedKV(bytes.NewBuffer(payload), mws, cor, m.lim)
+}
+
+// rekeyLine will write a line to the buffer, re-encoding it with the active key when needed
+func (m *MrT) rekeyLine(buf *bytes.Buffer, line []byte) (err error) {
+	if len(line) > 1 && isSegmentLine(line[0]) {
+		return m.rekeySegment(buf, line[:len(line)-1])
+	}
+
+	if len(line) < 2 || !isActionLine(line[0]) {
+		// Only puts and deletes reference keys
+		buf.Write(line)
+		return
+	}
+
+	lineType := line[0]
+	// Trim the line type and the trailing newline
+	payload := line[1 : len(line)-1]
+
+	var bucket []byte
+	if lineType == BucketPutLine || lineType == BucketDeleteLine {
+		if bucket, payload, err = getBucket(payload); err != nil {
+			return
+		}
+	}
+
+	if _, keyID, _, err := m.splitRecord(payload); err == nil && keyID == m.kr.Active() {
+		// Line is already using the active key
+		buf.Write(line)
+		return nil
+	}
+
+	var key, value []byte
+	if key, value, err = m.decodeKV(bytes.NewBuffer(payload), true); err != nil {
+		return
+	}
+
+	if bucket != nil {
+		return m.writeBucketLine(buf, lineType, bucket, key, value)
+	}
+
+	return m.writeLine(buf, lineType, key, value)
+}
+
+// rekeyArchive will rewrite the archive using the active key
+func (m *MrT) rekeyArchive() (err error) {
+	var (
+		tmpF File
+		tmpN string
+	)
+
+	if tmpF, tmpN, err = m.fs.TempFile(); err != nil {
+		return
+	}
+	defer m.fs.Remove(tmpN)
+	defer tmpF.Close()
+
+	r := newRekeyer(m, tmpF, 0, 0)
+
+	// Rewrite the bulk of the archive while only holding a read lock
+	ar := m.af.Reader()
+	err = r.copy(ar)
+	ar.Close()
+
+	if err != nil {
+		return
+	}
+
+	// Hold the current file to block archives while we swap the archive contents
+	return m.f.With(func(f File) (err error) {
+		return m.af.With(func(af File) (err error) {
+			// Rewrite anything which was archived since our first pass
+			if _, err = af.Seek(r.roff, io.SeekStart); err != nil {
+				return
+			}
+
+			if err = r.copy(af); err != nil {
+				return
+			}
+
+			// Replace the archive with our rewritten copy, an interrupted rekey leaves the archive intact
+			if err = m.af.replace(func(rf File) (err error) {
+				if _, err = tmpF.Seek(0, io.SeekStart); err != nil {
+					return
+				}
+
+				if _, err = io.Copy(rf, tmpF); err != nil {
+					return
+				}
+
+				return rf.Sync()
+			}); err != nil {
+				return
+			}
+
+			// Lines within segments have moved, rebuild our key index rather than remapping it
+			return m.idx.rebuild(func() (err error) {
+				// Our archive handle references the replaced contents, our copy matches the new archive
+				if _, err = tmpF.Seek(0, io.SeekStart); err != nil {
+					return
+				}
+
+				if err = m.idx.indexLines(m, tmpF, true, 0); err != nil {
+					return
+				}
+
+				if _, err = f.Seek(0, io.SeekStart); err != nil {
+					return
+				}
+
+				if err = m.idx.indexLines(m, f, false, 0); err != nil {
+					return
+				}
+
+				_, err = f.Seek(0, io.SeekEnd)
+				return
+			})
+		})
+	})
+}
+
+func (m *MrT) newTxnID() string {
+	return m.ug.New().String()
+}
+
+// filter will iterate through filtered lines
+func (m *MrT) filter(ctx context.Context, txnID string, archive bool, fn FilterFn, filters []Filter) (err error) {
+	var lines int64
+	start := time.Now()
+	defer func() { m.observe(OpFilter, start, 0, lines, err) }()
+
+	f := newFilter(fn, filters)
+	filterLine := withContext(ctx, f.processLine)
+	processLine := func(buf *bytes.Buffer) error {
+		lines++
+		return filterLine(buf)
+	}
+
+	curR := m.reader()
+	defer curR.Close()
+	// Our reader is used to check the current file, a second reader could block behind a waiting writer
+	inCurrent := isInFile(curR, txnID)
+	s := seeker.New(curR)
+
+	if archive && !inCurrent {
+		if err = m.readArchiveLines(processLine); err == nil {
+			if _, err = nextTxn(s); err == ErrNoTxn {
+				// We do not have any new transactions after our replay id, no need to read from current
+				return nil
+			} else if err != nil {
+				return
+			}
+		} else if os.IsNotExist(err) {
+			// No archive exists, we can still pull from current though
+			err = nil
+		} else {
+			return
+		}
+	}
+
+	if err = s.ReadLines(processLine); err != nil && os.IsNotExist(err) {
+		err = nil
+	}
+
+	return
+}
+
+func (m *MrT) processLine(buf *bytes.Buffer) (lineType byte, key, value []byte, err error) {
+	if lineType, err = buf.ReadByte(); err != nil {
+		// Error encountered getting line type
+		return
+	}
+
+	switch lineType {
+	case TransactionLine:
+		key, value, err = getKV(buf.Bytes())
+
+	case CommentLine, ReplayLine, HeaderLine:
+		key, value, err = getKV(buf.Bytes())
+
+	case PutLine, DeleteLine:
+		key, value, err = m.decodeKV(buf, m.cor)
+
+	case BucketPutLine, BucketDeleteLine:
+		var payload []byte
+		if _, payload, err = getBucket(buf.Bytes()); err != nil {
+			return
+		}
+
+		key, value, err = m.decodeKV(bytes.NewBuffer(payload), m.cor)
+
+	default:
+		err = ErrInvalidLine
+	}
+
+	return
+}
+
+func (m *MrT) parseImportPayload(w File, r io.Reader) (err error) {
+	var (
+		tmpF File
+		tmpN string
+	)
+
+	if tmpF, tmpN, err = m.fs.TempFile(); err != nil {
+		return
+	}
+	defer m.fs.Remove(tmpN)
+	defer tmpF.Close()
+
+	if _, err = io.Copy(tmpF, r); err != nil {
+		return
+	}
+
+	if _, err = tmpF.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	var signed bool
+	if signed, err = isSigned(tmpF); err != nil {
+		return
+	}
+
+	switch {
+	case m.verifiers != nil && !signed:
+		return ErrUnsignedExport
+	case m.verifiers != nil:
+		// Parse payload, check for a valid signature from a known key
+		err = m.parseSigned(tmpF, w)
+	case signed:
+		// Without verifiers the signature cannot be checked
+		return ErrUnverifiedSignature
+	default:
+		// Parse payload, check for proper token and signature
+		_, _, err = shasher.ParseWithToken(m.getToken(), tmpF, w)
+	}
+
+	if err != nil {
+		return
+	}
+
+	_, err = w.Seek(0, io.SeekStart)
+	return
+}
+
+func (m *MrT) appendImportPayload(ctx context.Context, f File) (n int64, err error) {
+	// Acquire an appender
+	a := m.f.Appender()
+	defer a.Close()
+	if m.failed.Get() {
+		return 0, ErrFailed
+	}
+	// Our context may have been cancelled while we waited for the appender
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	var start int64
+	if start, err = a.Seek(0, io.SeekCurrent); err != nil {
+		return
+	}
+
+	if m.idx.isEnabled() {
+		if err = m.indexImportPayload(f, start); err != nil {
+			// Nothing has been written, drop the references we have indexed so far
+			m.idx.drop(start)
+			return
+		}
+	}
+
+	// Copy payload to appender, a done context rolls back the partial copy
+	if n, err = io.Copy(a, newContextReader(ctx, f)); err != nil {
+		if rerr := m.rollbackImport(a, start); rerr != nil {
+			err = rerr
+		}
+
+		return
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	m.stats.add(m, f)
+	// Reset position before being used again
+	_, err = f.Seek(0, io.SeekStart)
+	return
+}
+
+// checkImportOrder will log an import conflict when an import payload begins before our last transaction
+// Note: Conflicting payloads are still imported, the reader of the payload is reset to the start
+func (m *MrT) checkImportOrder(f File) (err error) {
+	lastTxn := m.ltxn.Load()
+	if lastTxn == "" {
+		return
+	}
+
+	var firstTxn string
+	if firstTxn, err = peekFirstTxn(seeker.New(f)); err != nil && err != ErrNoTxn {
+		return
+	}
+
+	first, ferr := getTxnTime(firstTxn)
+	last, lerr := getTxnTime(lastTxn)
+	if ferr == nil && lerr == nil && !first.After(last) {
+		m.log.Warn("import conflict, payload begins before the last transaction", "name", m.name,
+			"firstTxn", firstTxn, "lastTxn", lastTxn)
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	return
+}
+
+// rollbackImport will remove a partially appended import payload along with it's key index references
+func (m *MrT) rollbackImport(a File, start int64) (err error) {
+	if err = m.rollback(a, start); err != nil {
+		return
+	}
+
+	m.log.Warn("rolled back partial import", "name", m.name, "offset", start)
+	return
+}
+
+// rollback will remove a partial write following offset along with it's key index references
+// Note: When the partial write cannot be removed the database is failed, writes return ErrFailed until recovered
+func (m *MrT) rollback(a File, offset int64) (err error) {
+	m.idx.drop(offset)
+	if err = a.Truncate(offset); err == nil {
+		_, err = a.Seek(offset, io.SeekStart)
+	}
+
+	if err != nil {
+		m.failed.Set(true)
+		m.log.Error("failed to roll back partial write", "name", m.name, "offset", offset, "error", err)
+	}
+
+	return
+}
+
+func (m *MrT) indexImportPayload(f File, offset int64) (err error) {
+	if err = m.idx.index(m, f, false, offset); err != nil {
+		return
+	}
+
+	// Reset position before being used again
+	_, err = f.Seek(0, io.SeekStart)
+	return
+}
+
+func (m *MrT) exportArchive(e *exporter) (err error) {
+	err = e.exportLines(m.readArchiveLines)
+	switch {
+	case err == ErrNoTxn:
+		err = ErrInvalidTxn
+	case os.IsNotExist(err):
+		err = nil
+	}
+
+	return
+}
+
+func (m *MrT) archive(ctx context.Context, f File, c *commit, populate TxnFn) (err error) {
+	var archived int64
+	start := time.Now()
+	defer func() { m.observe(OpArchive, start, archived, 0, err) }()
+
+	if m.closed.Get() {
+		return errors.ErrIsClosed
+	}
+
+	if m.failed.Get() {
+		return ErrFailed
+	}
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	// Acquire an archive writer
+	aw := m.af.Writer()
+	// Defer the closure of our archive writer
+	defer aw.Close()
+	// Ensure archive file is at the end
+	var archiveOffset int64
+	if archiveOffset, err = aw.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			// Roll back anything we have written to the archive, the current file is left intact
+			aw.Truncate(archiveOffset)
+			m.log.Warn("rolled back archive", "name", m.name, "error", err)
+		}
+	}()
+	// Seek to the first transaction within our file
+	// Note: Replay lines do not count as a transaction, this will move to the first txn AFTER the replay line (if it exists)
+	if err = seekFirstTxn(f); err != nil {
+		return
+	}
+	// Get the current offset so our index knows where the archived lines started
+	var currentOffset int64
+	if currentOffset, err = f.Seek(0, io.SeekCurrent); err != nil {
+		return
+	}
+	// Stop copying once our context is done, our deferred rollback will clear the partial copy
+	src := newContextReader(ctx, f)
+	var (
+		// Archive destination, this is a segment buffer when compressing
+		dst io.Writer = aw
+		seg *bytes.Buffer
+		// Offset of the first archived line within our destination
+		dstOffset = archiveOffset
+	)
+
+	if m.compressArchive {
+		seg = bytes.NewBuffer(nil)
+		dst = seg
+		dstOffset = 0
+	}
+
+	var remap func(ref keyRef) (keyRef, bool)
+	if m.kr == nil {
+		// Copy from file to archive destination
+		if _, err = io.Copy(dst, src); err != nil {
+			return
+		}
+
+		remap = newRotation(currentOffset, dstOffset)
+	} else {
+		// Copy from file to archive destination, re-encoding lines which are not using the active key
+		r := newRekeyer(m, dst, currentOffset, dstOffset)
+		if err = r.copy(src); err != nil {
+			return
+		}
+
+		remap = func(ref keyRef) (keyRef, bool) {
+			return r.remap(ref, false)
+		}
+	}
+
+	if seg != nil && seg.Len() > 0 {
+		// Write our archived lines as a single compressed segment
+		if err = m.sealSegment(aw, seg.Bytes()); err != nil {
+			return
+		}
+
+		remap = newSegmentRotation(remap, archiveOffset)
+	}
+	// Ensure our archived lines are persisted before they are removed from the current file
+	if err = aw.Sync(); err != nil {
+		return
+	}
+
+	if archived, err = aw.Seek(0, io.SeekCurrent); err != nil {
+		return
+	}
+
+	archived -= archiveOffset
+	// Replace the current file with our replay line, an interrupted archive leaves the current file intact
+	if err = m.lbuf.Update(func(buf *bytes.Buffer) error {
+		return m.f.replace(func(rf File) error {
+			return m.writeReplay(rf, buf, c, func(txn *Txn) (err error) {
+				if err = populate(txn); err != nil {
+					return
+				}
+
+				// Nothing has been replaced yet, a done context still rolls everything back
+				return ctx.Err()
+			})
+		})
+	}); err != nil {
+		return
+	}
+	// Point our key index references to their new home within the archive
+	m.idx.remap(remap)
+	m.stats.rotate()
+	m.log.Info("archived current file", "name", m.name, "bytes", archived)
+	return
+}
+
+func (m *MrT) writeReplay(f File, buf *bytes.Buffer, c *commit, populate TxnFn) (err error) {
+	txn := m.newTxn(buf, c)
+	defer txn.clear()
+
+	// The file has been cleared, our header needs to be written before anything else
+	if err = m.writeHeader(buf); err != nil {
+		return
+	}
+
+	replayID := m.ltxn.Load()
+	if err = txn.writeLine(buf, ReplayLine, []byte(replayID), nil); err != nil {
+		return
+	}
+
+	if err = populate(&txn); err != nil {
+		return
+	}
+
+	if err = c.before(replayID); err != nil {
+		return
+	}
+
+	if _, err = f.Write(buf.Bytes()); err != nil {
+		return
+	}
+
+	return f.Sync()
+}
+
+// Txn will create a transaction
+func (m *MrT) Txn(fn TxnFn) (err error) {
+	return m.TxnContext(context.Background(), fn)
+}
+
+// TxnContext will create a transaction, nothing is written when the context is done before the transaction is
+// appended
+// Note: Once appended, the transaction is committed regardless of the context
+func (m *MrT) TxnContext(ctx context.Context, fn TxnFn) (err error) {
+	var written int64
+	start := time.Now()
+	defer func() { m.observe(OpTxn, start, written, 0, err) }()
+
+	if m.readOnly {
+		return ErrReadOnly
+	}
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	c := m.newCommit()
+	// Our after commit hooks are called once the appender has been released
+	defer func() {
+		if err == nil {
+			c.after()
+		}
+	}()
+	// Get a new appender
+	a := m.f.Appender()
+	// Defer closing the appender
+	defer a.Close()
+	// Check is MrT is closed
+	if m.closed.Get() {
+		return errors.ErrIsClosed
+	}
+
+	if m.failed.Get() {
+		return ErrFailed
+	}
+	// Our context may have been cancelled while we waited for the appender
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	// Assign a new transaction id
+	txnID := m.newTxnID()
+	// Lock buffer to write to and flush
+	if err = m.lbuf.Update(func(buf *bytes.Buffer) (err error) {
+		txn := m.newTxn(buf, c)
+		defer txn.clear()
+
+		if err = fn(&txn); err != nil {
+			// We encountered an error while calling func, avoid writing
+			return
+		}
+
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		if err = c.before(txnID); err != nil {
+			return
+		}
+
+		// Our transaction line records the size of our actions so a torn transaction can be detected
+		if err = m.writeTxnLine(buf, txnID); err != nil {
+			return
+		}
+
+		var offset int64
+		if offset, err = a.Seek(0, io.SeekCurrent); err != nil {
+			return
+		}
+
+		// Index before writing, an index error must not be returned for a transaction which has been written
+		if err = m.idx.index(m, bytes.NewReader(buf.Bytes()), false, offset); err != nil {
+			m.idx.drop(offset)
+			return
+		}
+
+		if _, err = a.Write(buf.Bytes()); err != nil {
+			// Roll back our partial write so the next transaction is not appended to a torn one
+			if rerr := m.rollback(a, offset); rerr != nil {
+				return rerr
+			}
+
+			m.log.Warn("rolled back partial transaction", "name", m.name, "txn", txnID, "error", err)
+			return
+		}
+
+		written = int64(buf.Len())
+
+		m.stats.add(m, bytes.NewReader(buf.Bytes()))
+		return
+	}); err != nil {
+		return
+	}
+
+	syncStart := time.Now()
+	err = a.Sync()
+	m.observe(OpSync, syncStart, written, 0, err)
+	if err != nil {
+		return
+	}
+
+	m.ltxn.Store(txnID)
+	return
+}
+
+// Comment will write a comment line
+func (m *MrT) Comment(b []byte) (err error) {
+	if m.readOnly {
+		return ErrReadOnly
+	}
+
+	a := m.f.Appender()
+	defer a.Close()
+	if m.closed.Get() {
+		return errors.ErrIsClosed
+	}
+
+	if m.failed.Get() {
+		return ErrFailed
+	}
+
+	return m.lbuf.Update(func(buf *bytes.Buffer) (err error) {
+		// Write the comment line
+		if err = m.writeLine(buf, CommentLine, b, nil); err != nil {
+			return
+		}
+
+		_, err = a.Write(buf.Bytes())
+		return
+	})
+}
+
+// BeforeCommit will register a hook called with the actions of each transaction before it is appended, an error
+// returned by the hook aborts the transaction
+// Note: Hooks are called for transactions, imported transactions and the replay block written by an archive
+// Note: Transaction and archive hooks are called while the write lock is held, a hook must not call back into MrT.
+// Reads block until the transaction has been appended, a hook waiting on one will never return
+func (m *MrT) BeforeCommit(fn BeforeCommitFn) {
+	m.hooks.addBefore(fn)
+}
+
+// AfterCommit will register a hook called with each transaction once it has been synced
+// Note: Hooks are called for transactions, imported transactions and the replay block written by an archive
+func (m *MrT) AfterCommit(fn AfterCommitFn) {
+	m.hooks.addAfter(fn)
+}
+
+// Filter will iterate through filtered lines
+func (m *MrT) Filter(txnID string, archive bool, fn FilterFn, filters ...Filter) (err error) {
+	return m.FilterContext(context.Background(), txnID, archive, fn, filters...)
+}
+
+// FilterContext will iterate through filtered lines, stopping before the next line once the context is done
+func (m *MrT) FilterContext(ctx context.Context, txnID string, archive bool, fn FilterFn, filters ...Filter) (err error) {
+	if m.closed.Get() {
+		return errors.ErrIsClosed
+	}
+
+	if err = m.follow(); err != nil {
+		return
+	}
+
+	if txnID != "" && txnID == m.ltxn.Load() {
+		return
+	}
+
+	setFiltersDecoder(filters, m.decodeKV)
+	return m.filter(ctx, txnID, archive, fn, filters)
+}
+
+// ForEach will iterate through all the file lines starting from the provided transaction id
+// Note: Optional filters can be provided to limit the lines which are iterated through
+func (m *MrT) ForEach(txnID string, archive bool, fn ForEachFn, filters ...Filter) (err error) {
+	return m.ForEachContext(context.Background(), txnID, archive, fn, filters...)
+}
+
+// ForEachContext will iterate through all the file lines starting from the provided transaction id, stopping
+// before the next line once the context is done
+func (m *MrT) ForEachContext(ctx context.Context, txnID string, archive bool, fn ForEachFn, filters ...Filter) (err error) {
+	filters = append([]Filter{NewMatch(txnID)}, filters...)
+	return m.FilterContext(ctx, txnID, archive, func(buf *bytes.Buffer) (err error) {
+		var (
+			lineType   byte
+			key, value []byte
+		)
+
+		if lineType, key, value, err = m.processLine(buf); err != nil {
+			return
+		}
+
+		return fn(lineType, key, value)
+	}, filters...)
+}
+
+// ForEachBucket will iterate through all the lines of a bucket starting from the provided transaction id
+// Note: Bucket put and delete lines will be provided as PutLine and DeleteLine
+func (m *MrT) ForEachBucket(bucket, txnID string, archive bool, fn ForEachFn, filters ...Filter) (err error) {
+	filters = append([]Filter{NewBuckets(bucket)}, filters...)
+	return m.ForEach(txnID, archive, func(lineType byte, key, value []byte) (err error) {
+		switch lineType {
+		case BucketPutLine:
+			lineType = PutLine
+		case BucketDeleteLine:
+			lineType = DeleteLine
+		}
+
+		return fn(lineType, key, value)
+	}, filters...)
+}
+
+// ForEachRaw will iterate through all the raw file lines starting from the provided transaction id
+// Note: Optional filters can be provided to limit the lines which are iterated through
+func (m *MrT) ForEachRaw(txnID string, archive bool, fn ForEachRawFn, filters ...Filter) (err error) {
+	filters = append([]Filter{NewMatch(txnID)}, filters...)
+	return m.Filter(txnID, archive, func(buf *bytes.Buffer) (err error) {
+		return fn(buf.Bytes())
+	}, filters...)
+}
+
+// ForEachLine will iterate through every line of the archive (when requested) followed by the current file
+// Note: Unlike ForEach, lines are not matched against a transaction and headers, replays and comments are included
+func (m *MrT) ForEachLine(archive bool, fn ForEachFn) (err error) {
+	if m.closed.Get() {
+		return errors.ErrIsClosed
+	}
+
+	if err = m.follow(); err != nil {
+		return
+	}
+
+	return m.readLines(archive, func(buf *bytes.Buffer) (err error) {
+		var (
+			lineType   byte
+			key, value []byte
+		)
+
+		if lineType, key, value, err = m.processLine(buf); err != nil {
+			return
+		}
+
+		return fn(lineType, key, value)
+	})
+}
+
+// ForEachTxn will iterate through all the file transactions starting from the provided transaction id
+// Note: Optional filters can be provided, transactions are included as a whole when any of their actions pass
+func (m *MrT) ForEachTxn(txnID string, archive bool, fn ForEachTxnFn, filters ...Filter) (err error) {
+	return m.ForEachTxnContext(context.Background(), txnID, archive, fn, filters...)
+}
+
+// ForEachTxnContext will iterate through all the file transactions starting from the provided transaction id,
+// stopping before the next line once the context is done
+// Note: The transaction being read when the context is done is not passed to fn
+func (m *MrT) ForEachTxnContext(ctx context.Context, txnID string, archive bool, fn ForEachTxnFn, filters ...Filter) (err error) {
+	if len(filters) > 0 {
+		setFiltersDecoder(filters, m.decodeKV)
+		tf := newTxnFilter(txnID, fn, filters, m.decodeKV, m.log)
+		return m.forEachTxn(txnID, archive, tf.fe, withContext(ctx, tf.processLine))
+	}
+
+	fe := newTxnForEacher(txnID, fn, m.decodeKV, m.log)
+	return m.forEachTxn(txnID, archive, fe, withContext(ctx, fe.processLine))
+}
+
+func (m *MrT) forEachTxn(txnID string, archive bool, fe *txnForEacher, processLine func(*bytes.Buffer) error) (err error) {
+	if m.closed.Get() {
+		return errors.ErrIsClosed
+	}
+
+	if err = m.follow(); err != nil {
+		return
+	}
+
+	var lines int64
+	start := time.Now()
+	defer func() { m.observe(OpFilter, start, 0, lines, err) }()
+
+	countLine := processLine
+	processLine = func(buf *bytes.Buffer) error {
+		lines++
+		return countLine(buf)
+	}
+
+	rdr := m.reader()
+	defer rdr.Close()
+	// Our reader is used to check the current file, a second reader could block behind a waiting writer
+	inCurrent := isInFile(rdr, txnID)
+	s := seeker.New(rdr)
+
+	if archive && !inCurrent {
+		if err = m.readArchiveLines(processLine); err != nil && !os.IsNotExist(err) {
+			return
+		}
+
+		if err = fe.flush(); err != nil {
+			return
+		}
+
+		fe.state = stateMatch
+	}
+
+	if err = s.ReadLines(processLine); err != nil {
+		return
+	}
+
+	return fe.flush()
+}
+
+// ForEachTxnBetween will iterate through all the transactions which occurred between the from and to times (inclusive)
+// Note: Both the archive and the current file will be searched
+func (m *MrT) ForEachTxnBetween(from, to time.Time, fn ForEachTxnFn) (err error) {
+	if m.closed.Get() {
+		return errors.ErrIsClosed
+	}
+
+	if err = m.follow(); err != nil {
+		return
+	}
+
+	var done bool
+	fe := newTxnForEacher("", func(ti *TxnInfo) (err error) {
+		var ts time.Time
+		if ts, err = getTxnTime(ti.ID); err != nil {
+			return
+		}
+
+		switch {
+		case ts.Before(from):
+			return
+		case ts.After(to):
+			// Transactions are in chronological order, there is nothing left for us to find
+			done = true
+			return seeker.ErrEndEarly
+		}
+
+		return fn(ti)
+	}, m.decodeKV, m.log)
+	fe.skipReplay = true
+
+	if err = m.readLines(!m.isTimeInCurrent(from), func(buf *bytes.Buffer) (err error) {
+		if done {
+			return seeker.ErrEndEarly
+		}
+
+		return fe.processLine(buf)
+	}); err != nil {
+		return
+	}
+
+	if err = fe.flush(); err == seeker.ErrEndEarly {
+		err = nil
+	}
+
+	return
+}
+
+// TxnAt will get the last transaction id which occurred at or before the provided time
+func (m *MrT) TxnAt(ts time.Time) (txnID string, err error) {
+	if m.closed.Get() {
+		err = errors.ErrIsClosed
+		return
+	}
+
+	if err = m.follow(); err != nil {
+		return
+	}
+
+	if err = m.readLines(!m.isTimeInCurrent(ts), func(buf *bytes.Buffer) (err error) {
+		var lineType byte
+		if lineType, err = buf.ReadByte(); err != nil {
+			return
+		}
+
+		if lineType != TransactionLine && lineType != ReplayLine {
+			return
+		}
+
+		tid := getKey(buf.Bytes())
+		if tid == "" {
+			// The replay line of an archived empty file is not a transaction
+			return
+		}
+
+		var tts time.Time
+		if tts, err = getTxnTime(tid); err != nil {
+			return
+		}
+
+		if tts.After(ts) {
+			// We've moved past our target time
+			return seeker.ErrEndEarly
+		}
+
+		txnID = tid
+		return
+	}); err != nil {
+		return
+	}
+
+	if txnID == "" {
+		err = ErrNoTxn
+	}
+
+	return
+}
+
+// StateAt will reconstruct the entire keyspace as of the provided transaction id
+// Note: Keys within buckets are not included, use BucketStateAt
+func (m *MrT) StateAt(txnID string) (state map[string][]byte, err error) {
+	return m.BucketStateAt("", txnID)
+}
+
+// BucketStateAt will reconstruct the keyspace of a bucket as of the provided transaction id
+func (m *MrT) BucketStateAt(bucket, txnID string) (state map[string][]byte, err error) {
+	var sb *stateBuilder
+	if sb, err = m.buildState(txnID, bucket, nil); err != nil {
+		return
+	}
+
+	state = sb.state
+	return
+}
+
+// StateAtTime will reconstruct the entire keyspace as of the provided time
+func (m *MrT) StateAtTime(ts time.Time) (state map[string][]byte, err error) {
+	var txnID string
+	if txnID, err = m.TxnAt(ts); err != nil {
+		return
+	}
+
+	return m.StateAt(txnID)
+}
+
+// GetAt will get the value of a key as of the provided transaction id
+// Note: Keys within buckets are not included, use BucketGetAt
+func (m *MrT) GetAt(key []byte, txnID string) (value []byte, err error) {
+	return m.BucketGetAt("", key, txnID)
+}
+
+// BucketGetAt will get the value of a bucket key as of the provided transaction id
+func (m *MrT) BucketGetAt(bucket string, key []byte, txnID string) (value []byte, err error) {
+	var sb *stateBuilder
+	if sb, err = m.buildState(txnID, bucket, key); err != nil {
+		return
+	}
+
+	var ok bool
+	if value, ok = sb.state[string(key)]; !ok {
+		err = ErrKeyNotFound
+	}
 
 	return
 }
 
-func (m *MrT) archive(f *os.File, populate TxnFn) (err error) {
+// GetAtTime will get the value of a key as of the provided time
+func (m *MrT) GetAtTime(key []byte, ts time.Time) (value []byte, err error) {
+	var txnID string
+	if txnID, err = m.TxnAt(ts); err != nil {
+		return
+	}
+
+	return m.GetAt(key, txnID)
+}
+
+// EnableKeyIndex will build a secondary index of put and delete lines by key, the index will
+// be maintained by all subsequent writes and used by KeyHistory to avoid full scans
+// Note: The index is held in memory and must be enabled each time MrT is opened
+func (m *MrT) EnableKeyIndex() (err error) {
 	if m.closed.Get() {
 		return errors.ErrIsClosed
 	}
-	// Acquire an archive writer
-	aw := m.af.Writer()
-	// Defer the closure of our archive writer
-	defer aw.Close()
-	// Ensure archive file is at the end
-	if _, err = aw.Seek(0, io.SeekEnd); err != nil {
+
+	if err = m.follow(); err != nil {
 		return
 	}
-	// Seek to the first transaction within our file
-	// Note: Replay lines do not count as a transaction, this will move to the first txn AFTER the replay line (if it exists)
-	if err = seekFirstTxn(f); err != nil {
+
+	if !m.readOnly {
+		// Hold the current file exclusively so no writes occur while we populate the index
+		return m.f.With(func(f File) (err error) {
+			return m.idx.enable(func() (err error) {
+				ar := m.af.Reader()
+				defer ar.Close()
+				return m.populateKeyIndex(f, ar)
+			})
+		})
+	}
+
+	// Hold our follow state, lines which have not been followed yet will be indexed once they are
+	// Note: Nothing writes to a read-only database, we do not take the write lock as it would wait on readers which
+	// are waiting on our follow state
+	m.folMux.Lock()
+	defer m.folMux.Unlock()
+
+	cr := capReader(m.f.Reader(), m.fol.size)
+	defer cr.Close()
+	ar := capReader(m.af.Reader(), m.fol.archiveSize)
+	defer ar.Close()
+
+	return m.idx.enable(func() error {
+		return m.populateKeyIndex(cr, ar)
+	})
+}
+
+// populateKeyIndex will index the lines of the archive followed by the current file
+func (m *MrT) populateKeyIndex(cr, ar io.Reader) (err error) {
+	if err = m.idx.indexLines(m, ar, true, 0); err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	return m.idx.indexLines(m, cr, false, 0)
+}
+
+// KeyHistory will iterate through every put and delete for a given key, oldest first
+// Note: The provided transaction info will not have it's actions populated. Keys within buckets are not included,
+// use BucketKeyHistory
+func (m *MrT) KeyHistory(key []byte, fn KeyHistoryFn) (err error) {
+	return m.BucketKeyHistory("", key, fn)
+}
+
+// BucketKeyHistory will iterate through every put and delete for a given key within a bucket, oldest first
+// Note: The provided transaction info will not have it's actions populated
+func (m *MrT) BucketKeyHistory(bucket string, key []byte, fn KeyHistoryFn) (err error) {
+	if m.closed.Get() {
+		return errors.ErrIsClosed
+	}
+
+	if err = m.follow(); err != nil {
+		return
+	}
+
+	if m.idx.isEnabled() {
+		return m.indexedKeyHistory(bucket, key, fn)
+	}
+
+	return m.scanKeyHistory(bucket, key, fn)
+}
+
+// LastTxn will get the last transaction id
+func (m *MrT) LastTxn() (txnID string, err error) {
+	if m.closed.Get() {
+		err = errors.ErrIsClosed
+		return
+	}
+
+	if err = m.follow(); err != nil {
+		return
+	}
+
+	txnID = m.ltxn.Load()
+	return
+}
+
+// Archive will archive the current data
+// Note: The populate func may write to buckets using txn.Bucket
+func (m *MrT) Archive(populate TxnFn) (err error) {
+	return m.ArchiveContext(context.Background(), populate)
+}
+
+// ArchiveContext will archive the current data, the archive is rolled back when the context is done before the
+// current file is replaced
+// Note: The populate func may write to buckets using txn.Bucket
+func (m *MrT) ArchiveContext(ctx context.Context, populate TxnFn) (err error) {
+	if m.readOnly {
+		return ErrReadOnly
+	}
+
+	c := m.newCommit()
+	if err = m.f.With(func(f File) (err error) {
+		return m.archive(ctx, f, c, populate)
+	}); err != nil {
+		return
+	}
+	// Our after commit hooks are called once the current file has been released
+	c.after()
+	return
+}
+
+// ArchiveBuckets will archive the current data, each bucket is populated by it's own func
+// Note: Populate is optional and will populate data outside of buckets
+func (m *MrT) ArchiveBuckets(populate TxnFn, buckets map[string]BucketTxnFn) (err error) {
+	return m.Archive(func(txn *Txn) (err error) {
+		if populate != nil {
+			if err = populate(txn); err != nil {
+				return
+			}
+		}
+
+		for name, fn := range buckets {
+			if err = fn(txn.Bucket(name)); err != nil {
+				return
+			}
+		}
+
 		return
+	})
+}
+
+// GetFromRaw will get a key and value line from a raw entry
+func (m *MrT) GetFromRaw(raw []byte) (key, value []byte, err error) {
+	buf := bytes.NewBuffer(raw)
+	return m.decodeKV(buf, m.cor)
+}
+
+// Rekey will rewrite the archive so every put and delete uses the active key ring key
+// Note: Lines within the current file are rewritten as they are archived. Rekey is safe to call in the background,
+// writes are only blocked while the rewritten archive is swapped in
+func (m *MrT) Rekey() (err error) {
+	if m.closed.Get() {
+		return errors.ErrIsClosed
+	}
+
+	if m.readOnly {
+		return ErrReadOnly
 	}
-	// Copy from file to archive writer
-	if _, err = io.Copy(aw, f); err != nil {
-		return
+
+	if m.kr == nil {
+		return ErrNoKeyRing
 	}
-	// Clear file
-	if err = clearFile(f); err != nil {
-		return
+
+	if m.failed.Get() {
+		return ErrFailed
 	}
-	// Write replay line to file
-	return m.lbuf.Update(func(buf *bytes.Buffer) error {
-		return m.writeReplay(f, buf, populate)
-	})
+
+	return m.rekeyArchive()
 }
 
-func (m *MrT) writeReplay(f *os.File, buf *bytes.Buffer, populate TxnFn) (err error) {
-	txn := newTxn(buf, m.writeLine)
-	defer txn.clear()
+// Import will import a reader
+func (m *MrT) Import(r io.Reader, fn ForEachFn) (lastTxn string, err error) {
+	return m.ImportContext(context.Background(), r, fn)
+}
+
+// ImportContext will import a reader, nothing is imported when the context is done before the payload is appended
+// Note: Once appended, the payload is committed and fn is called for each line regardless of the context
+func (m *MrT) ImportContext(ctx context.Context, r io.Reader, fn ForEachFn) (lastTxn string, err error) {
+	return m.importUntil(ctx, r, "", fn)
+}
+
+// importUntil will import a reader, stopping after the provided transaction id (when set)
+// Note: The entire payload is imported when the transaction does not exist within it
+func (m *MrT) importUntil(ctx context.Context, r io.Reader, txnID string, fn ForEachFn) (lastTxn string, err error) {
+	var appended, lines int64
+	start := time.Now()
+	defer func() { m.observe(OpImport, start, appended, lines, err) }()
 
-	if err = txn.writeLine(buf, ReplayLine, []byte(m.ltxn.Load()), nil); err != nil {
+	if m.readOnly {
+		err = ErrReadOnly
 		return
 	}
 
-	if err = populate(&txn); err != nil {
+	var (
+		tmpF File
+		tmpN string
+	)
+
+	if tmpF, tmpN, err = m.fs.TempFile(); err != nil {
 		return
 	}
+	defer m.fs.Remove(tmpN)
+	defer tmpF.Close()
 
-	if _, err = f.Write(buf.Bytes()); err != nil {
+	if err = m.parseImportPayload(tmpF, newContextReader(ctx, r)); err != nil {
 		return
 	}
 
-	return f.Sync()
-}
+	if txnID != "" {
+		if err = truncateAfterTxn(tmpF, txnID); err != nil {
+			return
+		}
+	}
 
-// Txn will create a transaction
-func (m *MrT) Txn(fn TxnFn) (err error) {
-	// Get a new appender
-	a := m.f.Appender()
-	// Defer closing the appender
-	defer a.Close()
-	// Check is MrT is closed
-	if m.closed.Get() {
-		return errors.ErrIsClosed
+	if err = m.checkImportOrder(tmpF); err != nil {
+		return
 	}
-	// Assign a new transaction id
-	txnID := m.newTxnID()
-	// Lock buffer to write to and flush
-	if err = m.lbuf.Update(func(buf *bytes.Buffer) (err error) {
-		txn := newTxn(buf, m.writeLine)
-		defer txn.clear()
 
-		if err = m.writeLine(buf, TransactionLine, []byte(txnID), nil); err != nil {
+	hooked := m.hooks.isSet()
+	if hooked {
+		if err = m.forEachImportTxn(tmpF, func(ti *TxnInfo) error {
+			return m.hooks.beforeCommit(ti.ID, ti.Actions)
+		}); err != nil {
 			return
 		}
+	}
 
-		if err = fn(&txn); err != nil {
-			// We encountered an error while calling func, avoid writing
+	if appended, err = m.appendImportPayload(ctx, tmpF); err != nil {
+		return
+	}
+
+	s := seeker.New(tmpF)
+	err = s.ReadLines(func(buf *bytes.Buffer) (err error) {
+		var (
+			lineType byte
+			key, val []byte
+		)
+
+		lines++
+
+		if lineType, key, val, err = m.processLine(buf); err != nil {
 			return
 		}
 
-		_, err = a.Write(buf.Bytes())
-		return
-	}); err != nil {
+		if lineType == TransactionLine || lineType == ReplayLine {
+			lastTxn = string(key)
+		}
+
+		return fn(lineType, key, val)
+	})
+
+	m.ltxn.Store(lastTxn)
+	if !hooked {
 		return
 	}
 
-	if err = a.Sync(); err != nil {
-		return
+	// The payload has been committed, our after commit hooks are called regardless of fn
+	if herr := m.forEachImportTxn(tmpF, func(ti *TxnInfo) error {
+		m.hooks.afterCommit(ti)
+		return nil
+	}); err == nil {
+		err = herr
 	}
 
-	m.ltxn.Store(txnID)
 	return
 }
 
-// Comment will write a comment line
-func (m *MrT) Comment(b []byte) (err error) {
-	a := m.f.Appender()
-	defer a.Close()
-	if m.closed.Get() {
-		return errors.ErrIsClosed
-	}
-
-	return m.lbuf.Update(func(buf *bytes.Buffer) (err error) {
-		// Write the comment line
-		if err = m.writeLine(buf, CommentLine, b, nil); err != nil {
-			return
-		}
+// Export will export from a given transaction id
+func (m *MrT) Export(txnID string, w io.Writer) (err error) {
+	return m.ExportContext(context.Background(), txnID, w)
+}
 
-		_, err = a.Write(buf.Bytes())
-		return
-	})
+// ExportContext will export from a given transaction id, stopping once the context is done
+// Note: An export which has been stopped is incomplete, anything written to w should be discarded
+func (m *MrT) ExportContext(ctx context.Context, txnID string, w io.Writer) (err error) {
+	_, err = m.export(ctx, txnID, w)
+	return
 }
 
-// Filter will iterate through filtered lines
-func (m *MrT) Filter(txnID string, archive bool, fn FilterFn, filters ...Filter) (err error) {
-	if m.closed.Get() {
-		return errors.ErrIsClosed
+// export will export from a given transaction id, returning the last exported transaction id
+func (m *MrT) export(ctx context.Context, txnID string, w io.Writer) (lastTxn string, err error) {
+	cw := countWriter{w: w}
+	e := newExporter(ctx, m, &cw, txnID)
+	start := time.Now()
+	defer func() { m.observe(OpExport, start, cw.n, e.lines, err) }()
+
+	if err = m.follow(); err != nil {
+		return
 	}
 
 	if txnID != "" && txnID == m.ltxn.Load() {
+		err = ErrNoTxn
 		return
 	}
 
-	return m.filter(txnID, archive, fn, filters)
-}
-
-// ForEach will iterate through all the file lines starting from the provided transaction id
-func (m *MrT) ForEach(txnID string, archive bool, fn ForEachFn) (err error) {
-	match := NewMatch(txnID)
-	return m.Filter(txnID, archive, func(buf *bytes.Buffer) (err error) {
-		var (
-			lineType   byte
-			key, value []byte
-		)
+	// Assign current reader to aquire read-lock for file
+	var cr *fileReader
+	cr, lastTxn = m.lastTxnReader()
+	defer cr.Close()
 
-		if lineType, key, value, err = m.processLine(buf); err != nil {
+	if txnID == "" || !isInFile(cr, txnID) {
+		if err = m.exportArchive(&e); err != nil {
 			return
 		}
+	}
 
-		return fn(lineType, key, value)
-	}, match)
+	if err = e.exportFrom(cr, lastTxn); err != nil {
+		return
+	}
+
+	if e.hw != nil {
+		_, err = e.hw.Sign()
+	}
+
+	return
 }
 
-// ForEachRaw will iterate through all the raw file lines starting from the provided transaction id
-func (m *MrT) ForEachRaw(txnID string, archive bool, fn ForEachRawFn) (err error) {
-	match := NewMatch(txnID)
-	return m.Filter(txnID, archive, func(buf *bytes.Buffer) (err error) {
-		return fn(buf.Bytes())
-	}, match)
+// Backup will write a consistent snapshot of the current and archive files to w
+// Note: Transactions and archives are blocked while the backup is being written
+func (m *MrT) Backup(w io.Writer) (err error) {
+	_, err = m.backup(w)
+	return
 }
 
-// ForEachTxn will iterate through all the file transactions starting from the provided transaction id
-func (m *MrT) ForEachTxn(txnID string, archive bool, fn ForEachTxnFn) (err error) {
-	fe := newTxnForEacher(txnID, fn, m.mw)
+// backup will write a consistent snapshot to w, returning the last backed up transaction id
+func (m *MrT) backup(w io.Writer) (lastTxn string, err error) {
 	if m.closed.Get() {
-		return errors.ErrIsClosed
+		err = errors.ErrIsClosed
+		return
 	}
 
-	rdr := m.f.Reader()
-	defer rdr.Close()
-	s := seeker.New(rdr)
+	if err = m.follow(); err != nil {
+		return
+	}
 
-	if archive && !m.isInCurrent(txnID) {
-		if err = m.readArchiveLines(fe.processLine); err != nil && !os.IsNotExist(err) {
-			return
-		}
+	var mf manifest
+	mf.Version = FormatVersion
+	mf.Name = m.name
+	mf.Created = time.Now().UnixNano()
 
-		fe.flush()
-		fe.state = stateMatch
-		err = nil
+	tw := tar.NewWriter(w)
+	if lastTxn, err = m.snapshot(func(name string, r io.ReadSeeker) error {
+		return writeBackupFile(tw, &mf, name, r)
+	}); err != nil {
+		return
+	}
+
+	var b []byte
+	if b, err = json.Marshal(&mf); err != nil {
+		return
+	}
+
+	if err = writeBackupHeader(tw, backupManifest, int64(len(b))); err != nil {
+		return
 	}
 
-	if err = s.ReadLines(fe.processLine); err != nil {
+	if _, err = tw.Write(b); err != nil {
 		return
 	}
 
-	fe.flush()
+	err = tw.Close()
 	return
 }
 
-// LastTxn will get the last transaction id
-func (m *MrT) LastTxn() (txnID string, err error) {
+// BackupTo will write a consistent snapshot of the current and archive files to the provided directory
+// Note: The backup can be opened directly using the same name and options
+func (m *MrT) BackupTo(dir string) (err error) {
 	if m.closed.Get() {
-		err = errors.ErrIsClosed
+		return errors.ErrIsClosed
+	}
+
+	if err = m.follow(); err != nil {
 		return
 	}
 
-	txnID = m.ltxn.Load()
-	return
-}
+	if err = m.fs.MkdirAll(path.Join(dir, "archive")); err != nil {
+		return
+	}
 
-// Archive will archive the current data
-func (m *MrT) Archive(populate TxnFn) (err error) {
-	return m.f.With(func(f *os.File) (err error) {
-		return m.archive(f, populate)
+	current, archive := getPaths(dir, m.name)
+	_, err = m.snapshot(func(name string, r io.ReadSeeker) (err error) {
+		if _, err = r.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+
+		if name == backupCurrent {
+			return copyToFile(m.fs, current, r)
+		}
+
+		return copyToFile(m.fs, archive, r)
 	})
-}
 
-// GetFromRaw will get a key and value line from a raw entry
-func (m *MrT) GetFromRaw(raw []byte) (key, value []byte, err error) {
-	buf := bytes.NewBuffer(raw)
-	return getProcessedKV(buf, m.mw, m.cor)
+	return
 }
 
-// Import will import a reader
-func (m *MrT) Import(r io.Reader, fn ForEachFn) (lastTxn string, err error) {
-	var (
-		tmpF *os.File
-		tmpN string
-	)
+// BackupIncremental will add a backup to the backup chain within the provided directory
+// Note: A full base backup is written when the chain does not exist, otherwise the backup contains the
+// transactions since the last backup within the chain. ErrNoTxn is returned when there is nothing to back up
+func (m *MrT) BackupIncremental(dir string) (ce ChainEntry, err error) {
+	if err = m.fs.MkdirAll(dir); err != nil {
+		return
+	}
 
-	if tmpF, tmpN, err = getTmp(); err != nil {
+	var c *chain
+	if c, err = readChain(m.fs, dir); err == ErrNoBackupChain {
+		c = &chain{Version: FormatVersion, Name: m.name}
+	} else if err != nil {
 		return
 	}
-	defer os.Remove(tmpN)
 
-	if err = m.parseImportPayload(tmpF, r); err != nil {
+	if c.Name != m.name {
+		err = ErrBrokenChain
 		return
 	}
 
-	if err = m.appendImportPayload(tmpF); err != nil {
+	prev, ok := c.last()
+	ce.Seq = len(c.Entries)
+	ce.Full = !ok
+	ce.From = prev.To
+	ce.File = getChainFileName(ce.Seq, ce.Full)
+	ce.Created = time.Now().UnixNano()
+
+	if ce.Checksum, err = writeChainFile(m.fs, dir, ce.File, func(w io.Writer) (err error) {
+		if ce.Full {
+			ce.To, err = m.backup(w)
+			return
+		}
+
+		ce.To, err = m.export(context.Background(), ce.From, w)
+		return
+	}); err != nil {
 		return
 	}
 
-	s := seeker.New(tmpF)
-	err = s.ReadLines(func(buf *bytes.Buffer) (err error) {
-		var (
-			lineType byte
-			key, val []byte
-		)
+	c.Entries = append(c.Entries, ce)
+	err = writeChain(m.fs, dir, c)
+	return
+}
 
-		if lineType, key, val, err = m.processLine(buf); err != nil {
+// Recover will remove a torn or corrupted tail from the current file and the remains of an interrupted archive
+// from the archive, returning the number of bytes removed
+// Note: Any transaction containing a partial or invalid line is removed in it's entirety
+func (m *MrT) Recover() (removed int64, err error) {
+	if m.closed.Get() {
+		err = errors.ErrIsClosed
+		return
+	}
+
+	if m.readOnly {
+		err = ErrReadOnly
+		return
+	}
+
+	var offset, archiveOffset int64
+	if err = m.f.With(func(f File) (err error) {
+		if offset, err = m.getRecoveryOffset(f); err != nil {
 			return
 		}
 
-		if lineType == TransactionLine || lineType == ReplayLine {
-			lastTxn = string(key)
+		if removed, err = truncateTail(f, offset); err != nil {
+			return
 		}
 
-		return fn(lineType, key, val)
+		// Holding the current file blocks archives while we repair the archive
+		return m.af.With(func(af File) (err error) {
+			var firstTxn string
+			if firstTxn, err = peekFirstTxn(seeker.New(f)); err != nil && err != ErrNoTxn {
+				return
+			}
+
+			if archiveOffset, err = m.getArchiveRecoveryOffset(af, firstTxn); err != nil {
+				return
+			}
+
+			var archiveRemoved int64
+			if archiveRemoved, err = truncateTail(af, archiveOffset); err != nil {
+				return
+			}
+
+			removed += archiveRemoved
+			return
+		})
+	}); err != nil {
+		return
+	}
+
+	// Our torn tail has been removed, writes may resume
+	m.failed.Set(false)
+	if removed == 0 {
+		return
+	}
+
+	m.log.Warn("removed corrupt records", "name", m.name, "bytes", removed, "offset", offset, "archiveOffset", archiveOffset)
+	// Drop any key index references to removed lines
+	m.idx.remap(func(ref keyRef) (keyRef, bool) {
+		if ref.archived {
+			return ref, ref.offset < archiveOffset
+		}
+
+		return ref, ref.offset < offset
 	})
 
-	m.ltxn.Store(lastTxn)
+	m.stats.reset()
+	m.ltxn.Store("")
+	err = m.setLastTxn()
 	return
 }
 
-// Export will export from a given transaction id
-func (m *MrT) Export(txnID string, w io.Writer) (err error) {
-	if txnID != "" && txnID == m.ltxn.Load() {
-		return ErrNoTxn
+// Verify will validate every line of the archive and current file without modifying either
+// Note: Problems are reported within the returned report, errors are only returned when the files cannot be read
+func (m *MrT) Verify(opts VerifyOpts) (report VerifyReport, err error) {
+	if m.closed.Get() {
+		err = errors.ErrIsClosed
+		return
 	}
 
-	e := newExporter(m, w, txnID)
-	// Assign current reader to aquire read-lock for file
-	cr := m.f.Reader()
+	if err = m.follow(); err != nil {
+		return
+	}
+
+	// Hold both files so we verify a consistent pair
+	cr := m.reader()
 	defer cr.Close()
+	ar := m.archiveReader()
+	defer ar.Close()
 
-	if txnID == "" || !m.isInCurrent(txnID) {
-		if err = m.exportArchive(&e); err != nil {
+	v := newVerifier(m, opts)
+	if !opts.SkipArchive {
+		if err = v.verifyFile(ar, true); err != nil {
 			return
 		}
 	}
 
-	if err = e.exportFrom(cr); err != nil {
+	if err = v.verifyFile(cr, false); err != nil {
 		return
 	}
 
-	if e.hw != nil {
-		_, err = e.hw.Sign()
+	report = v.r
+	return
+}
+
+// Stats will return the sizes and contents of the current file and archive
+// Note: The first call scans both files, afterwards counts are updated as transactions are appended and archived
+func (m *MrT) Stats() (stats Stats, err error) {
+	if m.closed.Get() {
+		err = errors.ErrIsClosed
+		return
 	}
 
-	return
+	if err = m.follow(); err != nil {
+		return
+	}
+
+	cr := m.reader()
+	defer cr.Close()
+	ar := m.archiveReader()
+	defer ar.Close()
+	return m.stats.get(m, cr, ar)
+}
+
+// Header will return the file header
+func (m *MrT) Header() (hdr Header) {
+	return m.hdr
 }
 
 // Close will close MrT
@@ -630,10 +2446,25 @@ func (m *MrT) Close() (err error) {
 		return errors.ErrIsClosed
 	}
 
+	err = m.close()
+	m.ug = nil
+	return
+}
+
+// close will close our files and release our writer lock, anything which has not been opened is skipped
+func (m *MrT) close() (err error) {
 	var errs errors.ErrorList
-	errs.Push(m.f.Close())
-	errs.Push(m.af.Close())
+	if m.f != nil {
+		errs.Push(m.f.Close())
+	}
+
+	if m.af != nil {
+		errs.Push(m.af.Close())
+	}
+
+	if m.lock != nil {
+		errs.Push(m.lock.Close())
+	}
 
-	m.ug = nil
 	return errs.Err()
 }
@@ -0,0 +1,86 @@
+package mrT
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+const (
+	// OpTxn is a transaction, including the time spent waiting for the current file
+	OpTxn Op = "txn"
+	// OpSync is the sync of an appended transaction
+	OpSync Op = "sync"
+	// OpArchive is an archive of the current file
+	OpArchive Op = "archive"
+	// OpExport is an export
+	OpExport Op = "export"
+	// OpImport is an import
+	OpImport Op = "import"
+	// OpFilter is an iteration through the lines of the archive and current file (Filter, ForEach and ForEachTxn)
+	OpFilter Op = "filter"
+)
+
+// Op is a persistence operation reported to an Observer
+type Op string
+
+// Event is a completed persistence operation
+type Event struct {
+	Op Op
+	// Start is when the operation began
+	Start time.Time
+	// Duration of the operation
+	Duration time.Duration
+	// Bytes written by the operation (exported bytes for exports)
+	Bytes int64
+	// Lines scanned (or imported) by the operation
+	Lines int64
+	// Err is the error the operation returned, nil when successful
+	Err error
+}
+
+// Observer is notified of each completed persistence operation
+// Note: Observe is called synchronously by the goroutine performing the operation, it should not block
+type Observer interface {
+	Observe(e Event)
+}
+
+// observe will report an operation which began at start to our observer (if one is set)
+func (m *MrT) observe(op Op, start time.Time, bytes, lines int64, err error) {
+	if m.obs == nil {
+		return
+	}
+
+	m.obs.Observe(Event{
+		Op:       op,
+		Start:    start,
+		Duration: time.Since(start),
+		Bytes:    bytes,
+		Lines:    lines,
+		Err:      err,
+	})
+}
+
+// countWriter counts the bytes written through it
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(b []byte) (n int, err error) {
+	n, err = cw.w.Write(b)
+	cw.n += int64(n)
+	return
+}
+
+// lineCountReader counts the lines read through it
+type lineCountReader struct {
+	r     io.Reader
+	lines int64
+}
+
+func (lr *lineCountReader) Read(b []byte) (n int, err error) {
+	n, err = lr.r.Read(b)
+	lr.lines += int64(bytes.Count(b[:n], newlineBytes))
+	return
+}
@@ -0,0 +1,81 @@
+package mrT
+
+import (
+	"fmt"
+)
+
+const (
+	// DefaultMaxKeySize is the default maximum size of a key
+	DefaultMaxKeySize = 1 << 16
+	// DefaultMaxValueSize is the default maximum size of a value
+	DefaultMaxValueSize = 1 << 26
+
+	// maxFieldSize is the maximum size of any length prefixed field
+	maxFieldSize = 1 << 32
+)
+
+func newRecordError(err error, offset int64) *RecordError {
+	var r RecordError
+	r.Err = err
+	r.Offset = offset
+	return &r
+}
+
+// RecordError is returned when a record cannot be decoded
+type RecordError struct {
+	// Underlying error, ErrTruncatedRecord or ErrLengthOverflow
+	Err error
+	// Offset within the record where decoding failed
+	Offset int64
+}
+
+// Error will return the error string
+func (r *RecordError) Error() string {
+	return fmt.Sprintf("%v at record offset %d", r.Err, r.Offset)
+}
+
+// Unwrap will return the underlying error
+func (r *RecordError) Unwrap() error {
+	return r.Err
+}
+
+func newSizeLimits(maxKey, maxValue int) (s sizeLimits) {
+	if s.key = uint64(maxKey); maxKey <= 0 {
+		s.key = DefaultMaxKeySize
+	}
+
+	if s.value = uint64(maxValue); maxValue <= 0 {
+		s.value = DefaultMaxValueSize
+	}
+
+	return
+}
+
+// sizeLimits are the maximum key and value sizes of puts and deletes
+type sizeLimits struct {
+	key   uint64
+	value uint64
+}
+
+// check will ensure a key and value are within our limits
+func (s sizeLimits) check(key, value []byte) (err error) {
+	if uint64(len(key)) > s.key {
+		return ErrKeyTooLarge
+	}
+
+	if uint64(len(value)) > s.value {
+		return ErrValueTooLarge
+	}
+
+	return
+}
+
+// parseKV will extract the key and value from a payload, enforcing our limits
+func (s sizeLimits) parseKV(b []byte) (key, value []byte, err error) {
+	return parseKV(b, s.key, s.value)
+}
+
+// payloadSize will return the maximum size of an encoded key and value
+func (s sizeLimits) payloadSize() int64 {
+	return int64(s.key + s.value + 16)
+}
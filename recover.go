@@ -0,0 +1,163 @@
+package mrT
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/itsmontoya/seeker"
+)
+
+// getRecoveryOffset will return the offset the current file should be truncated to
+// Note: A transaction containing a partial or invalid line, or fewer data lines than it's transaction line
+// recorded, is considered torn and is removed in it's entirety
+func (m *MrT) getRecoveryOffset(f File) (offset int64, err error) {
+	var size int64
+	if size, err = f.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	var (
+		// Start of the last transaction block
+		txnStart int64 = -1
+		// Recorded and read sizes of the last transaction's data lines
+		txnSize, txnRead int64
+		// Whether or not the last transaction recorded it's size
+		sized bool
+		// Whether or not an invalid line was found
+		invalid bool
+	)
+
+	if err = forEachLine(f, 0, func(line []byte, lineOffset int64) (err error) {
+		var (
+			lineType byte
+			value    []byte
+		)
+
+		if lineType, _, value, err = m.processLine(bytes.NewBuffer(line)); err != nil {
+			invalid = true
+			return seeker.ErrEndEarly
+		}
+
+		switch {
+		case lineType == TransactionLine:
+			txnStart = lineOffset
+			txnSize, sized = getTxnSize(value)
+			txnRead = 0
+		case lineType == ReplayLine:
+			// Replays are written atomically along with their populated lines
+			sized = false
+		case isActionLine(lineType):
+			txnRead += int64(len(line)) + 1
+		}
+
+		offset = lineOffset + int64(len(line)) + 1
+		return
+	}); err != nil && err != seeker.ErrEndEarly {
+		return
+	}
+
+	err = nil
+	complete := !sized || txnRead >= txnSize
+	if !invalid && offset == size {
+		if !complete && txnStart >= 0 {
+			// File is intact, but our last transaction is missing lines
+			offset = txnStart
+		}
+
+		return
+	}
+
+	// Check if our damaged tail starts a new transaction, if so the previous transaction is complete
+	var lineType [1]byte
+	if _, err = f.ReadAt(lineType[:], offset); err != nil {
+		return
+	}
+
+	if (lineType[0] != TransactionLine || !complete) && txnStart >= 0 {
+		offset = txnStart
+	}
+
+	return
+}
+
+// getArchiveRecoveryOffset will return the offset the archive should be truncated to
+// Note: An interrupted archive can leave a partial line or a copy of the current file's leading transactions at
+// the end of the archive, the current file remains the home of it's transactions so both are removed
+func (m *MrT) getArchiveRecoveryOffset(af File, firstTxn string) (offset int64, err error) {
+	if _, err = af.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	if err = forEachLine(af, 0, func(line []byte, lineOffset int64) (err error) {
+		var ok bool
+		if ok, err = m.containsTxn(line, firstTxn); err != nil {
+			return
+		}
+
+		if ok {
+			return seeker.ErrEndEarly
+		}
+
+		offset = lineOffset + int64(len(line)) + 1
+		return
+	}); err == seeker.ErrEndEarly {
+		err = nil
+	}
+
+	return
+}
+
+// containsTxn will return whether or not a line is (or is a segment containing) the provided transaction
+func (m *MrT) containsTxn(line []byte, txnID string) (ok bool, err error) {
+	if len(line) == 0 || txnID == "" {
+		return
+	}
+
+	switch line[0] {
+	case TransactionLine:
+		ok = getKey(line[1:]) == txnID
+
+	case SegmentLine, TieredLine:
+		var lines []byte
+		if lines, err = m.readSegmentLine(line); err != nil {
+			return
+		}
+
+		err = forEachLine(bytes.NewReader(lines), 0, func(inner []byte, _ int64) (err error) {
+			if ok, err = m.containsTxn(inner, txnID); ok {
+				return seeker.ErrEndEarly
+			}
+
+			return
+		})
+
+		if err == seeker.ErrEndEarly {
+			err = nil
+		}
+	}
+
+	return
+}
+
+// truncateTail will truncate and sync a file when it is larger than the provided size
+func truncateTail(f File, size int64) (removed int64, err error) {
+	var current int64
+	if current, err = f.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+
+	if removed = current - size; removed <= 0 {
+		return 0, nil
+	}
+
+	if err = f.Truncate(size); err != nil {
+		return
+	}
+
+	err = f.Sync()
+	return
+}
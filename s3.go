@@ -0,0 +1,250 @@
+package mrT
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// s3Algorithm is the AWS signature version 4 signing algorithm
+	s3Algorithm = "AWS4-HMAC-SHA256"
+	// s3DateFormat is the format of AWS signature timestamps
+	s3DateFormat = "20060102T150405Z"
+)
+
+// S3Opts are the options used when creating an S3 object store
+type S3Opts struct {
+	// Endpoint is the base URL of the S3 API (e.g. https://s3.us-east-1.amazonaws.com or a local S3-compatible server)
+	Endpoint string
+	// Bucket objects are stored within
+	Bucket string
+	// Prefix (optional) is prepended to each object key
+	Prefix string
+	// Region requests are signed for, us-east-1 is used when unset
+	Region string
+	// AccessKeyID and SecretAccessKey are the credentials requests are signed with
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken (optional) is the session token of temporary credentials
+	SessionToken string
+	// Client (optional) is the HTTP client requests are made with, http.DefaultClient is used when unset
+	Client *http.Client
+}
+
+// NewS3Store will return a new object store using the S3 API
+// Note: Requests use path-style addressing and are signed using AWS signature version 4
+func NewS3Store(opts S3Opts) (s *S3Store, err error) {
+	var endpoint *url.URL
+	if endpoint, err = url.Parse(strings.TrimSuffix(opts.Endpoint, "/")); err != nil {
+		return
+	}
+
+	if endpoint.Scheme == "" || endpoint.Host == "" || opts.Bucket == "" {
+		err = ErrInvalidS3Opts
+		return
+	}
+
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	var store S3Store
+	store.opts = opts
+	store.endpoint = endpoint
+	s = &store
+	return
+}
+
+// S3Store is an object store using the S3 API
+type S3Store struct {
+	opts     S3Opts
+	endpoint *url.URL
+}
+
+// Put will store an object, replacing any existing object with the same key
+func (s *S3Store) Put(key string, value []byte) (err error) {
+	_, err = s.do(http.MethodPut, key, value)
+	return
+}
+
+// Get will retrieve an object, ErrObjectNotFound is returned when the object does not exist
+func (s *S3Store) Get(key string) (value []byte, err error) {
+	return s.do(http.MethodGet, key, nil)
+}
+
+// Delete will remove an object, deleting an object which does not exist is not an error
+func (s *S3Store) Delete(key string) (err error) {
+	if _, err = s.do(http.MethodDelete, key, nil); err == ErrObjectNotFound {
+		err = nil
+	}
+
+	return
+}
+
+// do will make a signed request for an object, returning the response body
+func (s *S3Store) do(method, key string, body []byte) (value []byte, err error) {
+	u := *s.endpoint
+	u.Path = u.Path + "/" + s.opts.Bucket + "/" + s.opts.Prefix + key
+	u.RawPath = uriEncode(u.Path, false)
+
+	var req *http.Request
+	if req, err = http.NewRequest(method, u.String(), bytes.NewReader(body)); err != nil {
+		return
+	}
+
+	req.Header.Set("X-Amz-Content-Sha256", getSHA256(body))
+	req.Header.Set("X-Amz-Date", time.Now().UTC().Format(s3DateFormat))
+	if s.opts.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.opts.SessionToken)
+	}
+
+	signS3Request(req, s.opts.Region, s.opts.AccessKeyID, s.opts.SecretAccessKey)
+
+	var resp *http.Response
+	if resp, err = s.opts.Client.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if value, err = ioutil.ReadAll(resp.Body); err != nil {
+		return
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return
+	case resp.StatusCode == http.StatusNotFound && method != http.MethodPut:
+		return nil, ErrObjectNotFound
+	}
+
+	e := S3Error{StatusCode: resp.StatusCode}
+	// The error body is optional, our status code is enough to report the error
+	xml.Unmarshal(value, &e)
+	return nil, &e
+}
+
+// S3Error is an error response from the S3 API
+type S3Error struct {
+	// HTTP status code of the response
+	StatusCode int `xml:"-"`
+	// S3 error code (e.g. AccessDenied)
+	Code string `xml:"Code"`
+	// Error message
+	Message string `xml:"Message"`
+}
+
+// Error will return the error string
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3 request failed with status %d: %s %s", e.StatusCode, e.Code, e.Message)
+}
+
+// signS3Request will sign a request using AWS signature version 4, every header set on the request is signed
+// Note: The X-Amz-Date and X-Amz-Content-Sha256 headers must be set before signing
+func signS3Request(req *http.Request, region, accessKeyID, secretAccessKey string) {
+	amzDate := req.Header.Get("X-Amz-Date")
+	scope := amzDate[:8] + "/" + region + "/s3/aws4_request"
+
+	headers := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		headers["host"] = req.Host
+	}
+
+	for name, values := range req.Header {
+		if name == "Authorization" {
+			continue
+		}
+
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.TrimSpace(value)
+		}
+
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n")
+	canonical.WriteString(uriEncode(req.URL.Path, false) + "\n")
+	canonical.WriteString(getCanonicalQuery(req.URL.Query()) + "\n")
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+	canonical.WriteString("\n" + signedHeaders + "\n")
+	canonical.WriteString(req.Header.Get("X-Amz-Content-Sha256"))
+
+	stringToSign := s3Algorithm + "\n" + amzDate + "\n" + scope + "\n" + getSHA256([]byte(canonical.String()))
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{amzDate[:8], region, "s3", "aws4_request"} {
+		key = getHMAC(key, part)
+	}
+
+	signature := hex.EncodeToString(getHMAC(key, stringToSign))
+	req.Header.Set("Authorization", s3Algorithm+" Credential="+accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// getCanonicalQuery will return the sorted and encoded query string of a request
+func getCanonicalQuery(query url.Values) string {
+	var pairs []string
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode will percent-encode every byte other than unreserved characters, slashes are encoded when encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			sb.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+
+	return sb.String()
+}
+
+func getSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func getHMAC(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,286 @@
+package mrT
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"hash"
+	"io"
+)
+
+const (
+	// AlgorithmHMAC is the HMAC-SHA256 signing algorithm
+	AlgorithmHMAC = "hmac-sha256"
+	// AlgorithmEd25519 is the Ed25519 signing algorithm
+	AlgorithmEd25519 = "ed25519"
+)
+
+var (
+	// signatureMagic prefixes the stream header of signed exports
+	signatureMagic = []byte("mrT-signed:")
+)
+
+// Verifier verifies export signatures
+type Verifier interface {
+	// KeyID will return the key id
+	KeyID() string
+	// Algorithm will return the signing algorithm
+	Algorithm() string
+	// Verify will verify the signature of a digest
+	Verify(digest, sig []byte) error
+}
+
+// Signer signs exports
+type Signer interface {
+	Verifier
+	// Sign will return the signature of a digest
+	Sign(digest []byte) (sig []byte, err error)
+}
+
+// NewHMACSigner will return a new HMAC-SHA256 signer using a shared secret
+// Note: HMAC signers are also used as verifiers by the importing side
+func NewHMACSigner(keyID string, secret []byte) *HMACSigner {
+	var h HMACSigner
+	h.keyID = keyID
+	h.secret = secret
+	return &h
+}
+
+// HMACSigner signs and verifies exports using a shared secret
+type HMACSigner struct {
+	keyID  string
+	secret []byte
+}
+
+// KeyID will return the key id
+func (h *HMACSigner) KeyID() string {
+	return h.keyID
+}
+
+// Algorithm will return the signing algorithm
+func (h *HMACSigner) Algorithm() string {
+	return AlgorithmHMAC
+}
+
+// Sign will return the signature of a digest
+func (h *HMACSigner) Sign(digest []byte) (sig []byte, err error) {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write(digest)
+	return mac.Sum(nil), nil
+}
+
+// Verify will verify the signature of a digest
+func (h *HMACSigner) Verify(digest, sig []byte) (err error) {
+	var expected []byte
+	if expected, err = h.Sign(digest); err != nil {
+		return
+	}
+
+	if !hmac.Equal(expected, sig) {
+		return ErrInvalidSignature
+	}
+
+	return
+}
+
+// NewEd25519Signer will return a new Ed25519 signer using a private key
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) *Ed25519Signer {
+	var e Ed25519Signer
+	e.Ed25519Verifier = NewEd25519Verifier(keyID, key.Public().(ed25519.PublicKey))
+	e.key = key
+	return &e
+}
+
+// Ed25519Signer signs exports using a private key
+type Ed25519Signer struct {
+	*Ed25519Verifier
+	key ed25519.PrivateKey
+}
+
+// Sign will return the signature of a digest
+func (e *Ed25519Signer) Sign(digest []byte) (sig []byte, err error) {
+	return ed25519.Sign(e.key, digest), nil
+}
+
+// NewEd25519Verifier will return a new Ed25519 verifier using a public key
+func NewEd25519Verifier(keyID string, key ed25519.PublicKey) *Ed25519Verifier {
+	var e Ed25519Verifier
+	e.keyID = keyID
+	e.key = key
+	return &e
+}
+
+// Ed25519Verifier verifies exports using a public key
+type Ed25519Verifier struct {
+	keyID string
+	key   ed25519.PublicKey
+}
+
+// KeyID will return the key id
+func (e *Ed25519Verifier) KeyID() string {
+	return e.keyID
+}
+
+// Algorithm will return the signing algorithm
+func (e *Ed25519Verifier) Algorithm() string {
+	return AlgorithmEd25519
+}
+
+// Verify will verify the signature of a digest
+func (e *Ed25519Verifier) Verify(digest, sig []byte) (err error) {
+	if !ed25519.Verify(e.key, digest, sig) {
+		return ErrInvalidSignature
+	}
+
+	return
+}
+
+// signatureHeader is the header line of a signed export
+type signatureHeader struct {
+	// Signing algorithm
+	Algorithm string `json:"alg"`
+	// Signing key id
+	KeyID string `json:"keyID"`
+}
+
+func newSignedWriter(w io.Writer, s Signer, token []byte) (sw *signedWriter, err error) {
+	var hdr signatureHeader
+	hdr.Algorithm = s.Algorithm()
+	hdr.KeyID = s.KeyID()
+
+	var b []byte
+	if b, err = json.Marshal(&hdr); err != nil {
+		return
+	}
+
+	var ss signedWriter
+	ss.w = w
+	ss.s = s
+	ss.h = newSignatureHash(token)
+
+	// Our header is signed along with the payload so the key id cannot be swapped
+	if _, err = ss.Write(append(append(append([]byte{}, signatureMagic...), b...), '\n')); err != nil {
+		return
+	}
+
+	sw = &ss
+	return
+}
+
+// signedWriter writes a signed export stream
+// Note: The stream is a header line, followed by the payload, the signature and the signature length
+type signedWriter struct {
+	w io.Writer
+	s Signer
+	h hash.Hash
+}
+
+func (s *signedWriter) Write(b []byte) (n int, err error) {
+	s.h.Write(b)
+	return s.w.Write(b)
+}
+
+// Sign will write the signature of everything written so far
+func (s *signedWriter) Sign() (sig []byte, err error) {
+	if sig, err = s.s.Sign(s.h.Sum(nil)); err != nil {
+		return
+	}
+
+	if _, err = s.w.Write(sig); err != nil {
+		return
+	}
+
+	var nbuf [8]byte
+	binary.LittleEndian.PutUint64(nbuf[:], uint64(len(sig)))
+	_, err = s.w.Write(nbuf[:])
+	return
+}
+
+// newSignatureHash will return the hash used for export digests
+// Note: The token binds the signature to our database name and middlewares, it is not written to the stream
+func newSignatureHash(token []byte) (h hash.Hash) {
+	h = sha256.New()
+	h.Write(token)
+	return
+}
+
+// isSigned will return whether or not the stream read by f is a signed export
+func isSigned(f File) (signed bool, err error) {
+	prefix := make([]byte, len(signatureMagic))
+	if _, err = io.ReadFull(f, prefix); err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	} else if err != nil {
+		return
+	}
+
+	signed = bytes.Equal(prefix, signatureMagic)
+	_, err = f.Seek(0, io.SeekStart)
+	return
+}
+
+// parseSigned will verify a signed export stream and write it's payload to w
+func (m *MrT) parseSigned(f File, w io.Writer) (err error) {
+	var size int64
+	if size, err = f.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+
+	var nbuf [8]byte
+	if size < int64(len(nbuf)) {
+		return ErrInvalidSignature
+	}
+
+	if _, err = f.ReadAt(nbuf[:], size-int64(len(nbuf))); err != nil {
+		return
+	}
+
+	sigLen := int64(binary.LittleEndian.Uint64(nbuf[:]))
+	// End of the signed content
+	end := size - int64(len(nbuf)) - sigLen
+	if sigLen < 0 || end < 0 {
+		return ErrInvalidSignature
+	}
+
+	sig := make([]byte, sigLen)
+	if _, err = f.ReadAt(sig, end); err != nil {
+		return
+	}
+
+	br := bufio.NewReader(io.NewSectionReader(f, 0, end))
+	var line []byte
+	if line, err = br.ReadBytes('\n'); err != nil {
+		return ErrInvalidSignature
+	}
+
+	var hdr signatureHeader
+	if err = json.Unmarshal(bytes.TrimSuffix(line[len(signatureMagic):], newlineBytes), &hdr); err != nil {
+		return ErrInvalidSignature
+	}
+
+	v, ok := m.verifiers[hdr.KeyID]
+	if !ok {
+		return ErrUnknownSigningKey
+	}
+
+	if v.Algorithm() != hdr.Algorithm {
+		return ErrSigningAlgorithm
+	}
+
+	h := newSignatureHash(m.getToken())
+	h.Write(line)
+	if _, err = io.Copy(h, br); err != nil {
+		return
+	}
+
+	if err = v.Verify(h.Sum(nil), sig); err != nil {
+		return
+	}
+
+	// Signature is valid, copy our payload
+	_, err = io.Copy(w, io.NewSectionReader(f, int64(len(line)), end-int64(len(line))))
+	return
+}
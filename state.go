@@ -0,0 +1,93 @@
+package mrT
+
+import (
+	"bytes"
+
+	"github.com/itsmontoya/seeker"
+)
+
+func newStateBuilder(m *MrT, txnID, bucket string, key []byte) *stateBuilder {
+	var sb stateBuilder
+	sb.m = m
+	sb.tid = txnID
+	sb.bucket = bucket
+	sb.key = key
+	sb.state = make(map[string][]byte)
+	return &sb
+}
+
+// stateBuilder reconstructs the keyspace as of a target transaction
+type stateBuilder struct {
+	m *MrT
+	// Target transaction id
+	tid string
+	// Target bucket, empty for the keys outside of buckets
+	bucket string
+	// Target key, nil when reconstructing the entire keyspace
+	key []byte
+	// Reconstructed state
+	state map[string][]byte
+
+	// Whether or not the target transaction has been reached
+	matched bool
+	// Whether or not we have moved past the target transaction
+	done bool
+}
+
+func (sb *stateBuilder) processLine(buf *bytes.Buffer) (err error) {
+	if sb.done {
+		return seeker.ErrEndEarly
+	}
+
+	var (
+		lineType   byte
+		key, value []byte
+	)
+
+	line := buf.Bytes()
+	if lineType, key, value, err = sb.m.processLine(buf); err != nil {
+		return
+	}
+
+	switch lineType {
+	case ReplayLine:
+		// Replay blocks are a checkpoint of the entire keyspace, start from a clean slate
+		sb.state = make(map[string][]byte)
+		sb.matched = sb.tid == string(key)
+
+	case TransactionLine:
+		if sb.matched {
+			// We've reached the transaction following our target, we're done!
+			sb.done = true
+			return seeker.ErrEndEarly
+		}
+
+		sb.matched = sb.tid == string(key)
+
+	case PutLine, BucketPutLine:
+		if !sb.isTarget(line, key) {
+			return
+		}
+
+		sb.state[string(key)] = append([]byte{}, value...)
+
+	case DeleteLine, BucketDeleteLine:
+		if !sb.isTarget(line, key) {
+			return
+		}
+
+		delete(sb.state, string(key))
+	}
+
+	return
+}
+
+// isTarget will return whether or not an action line belongs to our target bucket and key
+func (sb *stateBuilder) isTarget(line, key []byte) (ok bool) {
+	if sb.key != nil && !bytes.Equal(sb.key, key) {
+		return
+	}
+
+	bucket, err := lineBucket(line)
+	return err == nil && string(bucket) == sb.bucket
+}
@@ -0,0 +1,281 @@
+package mrT
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stats are the sizes and contents of the current file and archive
+type Stats struct {
+	// Size (in bytes) of the current file and archive
+	CurrentSize int64
+	ArchiveSize int64
+	// Transactions within the current file and archive
+	CurrentTxns int64
+	ArchiveTxns int64
+	// Put and delete actions within the current file (including it's replay block) and archive
+	CurrentActions int64
+	ArchiveActions int64
+	// Oldest and newest transaction times, zero when no transactions exist
+	Oldest time.Time
+	Newest time.Time
+	// Keys is the number of live keys, each live key is a single live record within the current file
+	// Note: Bucket keys are counted separately from keys outside of buckets
+	Keys int64
+	// DeadRecords are the actions within the current file which have been overwritten or deleted, archiving removes them
+	DeadRecords int64
+}
+
+// LiveRatio will return the ratio of live records to the actions within the current file
+// Note: An empty current file has a ratio of 1
+func (s *Stats) LiveRatio() float64 {
+	if s.CurrentActions == 0 {
+		return 1
+	}
+
+	return float64(s.Keys) / float64(s.CurrentActions)
+}
+
+// lineCounts are the transaction and action counts of a file
+type lineCounts struct {
+	txns    int64
+	actions int64
+	oldest  time.Time
+	newest  time.Time
+}
+
+// fileStats are the incrementally maintained counts of our files
+// Note: Counts are loaded by a scan on first use, afterwards they are updated as lines are appended and archived
+type fileStats struct {
+	mux sync.Mutex
+	// Whether or not our archive counts have been loaded
+	loaded bool
+	// Whether or not our current file counts have been loaded
+	currentLoaded bool
+
+	archive lineCounts
+	current lineCounts
+	// Actions within the replay block of the current file
+	replayActions int64
+	// Whether or not the last line read from the current file was within a replay block
+	inReplay bool
+	// Live keys of the current file
+	keys map[string]struct{}
+}
+
+// get will return our stats, cr and ar are read handles to the current file and archive
+// Note: The read handles must be held while calling get so appends are not counted twice
+func (s *fileStats) get(m *MrT, cr, ar File) (stats Stats, err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if err = s.load(m, cr, ar); err != nil {
+		return
+	}
+
+	if stats.CurrentSize, err = cr.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+
+	if stats.ArchiveSize, err = ar.Seek(0, io.SeekEnd); os.IsNotExist(err) {
+		// The writer of a read-only database has not archived yet
+		err = nil
+	} else if err != nil {
+		return
+	}
+
+	stats.CurrentTxns = s.current.txns
+	stats.ArchiveTxns = s.archive.txns
+	stats.CurrentActions = s.current.actions
+	stats.ArchiveActions = s.archive.actions
+
+	if stats.Oldest = s.archive.oldest; stats.Oldest.IsZero() {
+		stats.Oldest = s.current.oldest
+	}
+
+	if stats.Newest = s.current.newest; stats.Newest.IsZero() {
+		stats.Newest = s.archive.newest
+	}
+
+	stats.Keys = int64(len(s.keys))
+	stats.DeadRecords = s.current.actions - stats.Keys
+	return
+}
+
+// load will scan any files whose counts have not been loaded, the caller is expected to hold the lock
+func (s *fileStats) load(m *MrT, cr, ar File) (err error) {
+	if !s.loaded {
+		s.archive = lineCounts{}
+		if _, err = ar.Seek(0, io.SeekStart); err == nil {
+			err = s.count(m, ar, true)
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			return
+		}
+
+		s.currentLoaded = false
+	}
+
+	if !s.currentLoaded {
+		s.current = lineCounts{}
+		s.replayActions = 0
+		s.inReplay = false
+		s.keys = make(map[string]struct{})
+		if _, err = cr.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+
+		if err = s.count(m, cr, false); err != nil {
+			// Our counts are partial, they will be reloaded on next use
+			s.loaded = false
+			return
+		}
+	}
+
+	s.loaded = true
+	s.currentLoaded = true
+	return
+}
+
+// add will count the lines appended to the current file
+// Note: Lines which cannot be counted cause our counts to be reloaded on next use
+func (s *fileStats) add(m *MrT, r io.Reader) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.loaded || !s.currentLoaded {
+		// Appended lines will be included when our counts are loaded
+		return
+	}
+
+	if err := s.count(m, r, false); err != nil {
+		s.loaded = false
+	}
+}
+
+// rotate will move the transactions of the current file to the archive, the new current file is counted on next use
+func (s *fileStats) rotate() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.loaded || !s.currentLoaded {
+		s.loaded = false
+		return
+	}
+
+	// Replay blocks are not archived
+	s.archive.txns += s.current.txns
+	s.archive.actions += s.current.actions - s.replayActions
+	if s.archive.oldest.IsZero() {
+		s.archive.oldest = s.current.oldest
+	}
+
+	if !s.current.newest.IsZero() {
+		s.archive.newest = s.current.newest
+	}
+
+	s.currentLoaded = false
+}
+
+// reset will reload our counts on next use
+func (s *fileStats) reset() {
+	s.mux.Lock()
+	s.loaded = false
+	s.mux.Unlock()
+}
+
+// count will count the lines read from the provided reader, the caller is expected to hold the lock
+func (s *fileStats) count(m *MrT, r io.Reader, archived bool) (err error) {
+	return forEachLine(r, 0, func(line []byte, _ int64) (err error) {
+		if len(line) == 0 || !isSegmentLine(line[0]) {
+			return s.countLine(m, line, archived)
+		}
+
+		var lines []byte
+		if lines, err = m.readSegmentLine(line); err != nil {
+			return
+		}
+
+		return forEachLine(bytes.NewReader(lines), 0, func(line []byte, _ int64) error {
+			return s.countLine(m, line, archived)
+		})
+	})
+}
+
+// countLine will count a single line
+func (s *fileStats) countLine(m *MrT, line []byte, archived bool) (err error) {
+	if len(line) == 0 {
+		return
+	}
+
+	c := &s.current
+	if archived {
+		c = &s.archive
+	}
+
+	lineType := line[0]
+	switch {
+	case lineType == TransactionLine:
+		var key []byte
+		if key, _, err = getKV(line[1:]); err != nil {
+			return
+		}
+
+		c.txns++
+		s.inReplay = false
+		if ts, terr := getTxnTime(string(key)); terr == nil {
+			if c.oldest.IsZero() {
+				c.oldest = ts
+			}
+
+			c.newest = ts
+		}
+
+	case lineType == ReplayLine && !archived:
+		s.inReplay = true
+
+	case isActionLine(lineType):
+		c.actions++
+		if archived {
+			return
+		}
+
+		if s.inReplay {
+			s.replayActions++
+		}
+
+		return s.countKey(m, line)
+	}
+
+	return
+}
+
+// countKey will update the live keys of the current file using a put or delete line
+func (s *fileStats) countKey(m *MrT, line []byte) (err error) {
+	var (
+		lineType byte
+		key      []byte
+		// Keys are prefixed by their bucket (if any) so bucket keys are counted separately
+		prefix []byte
+	)
+
+	if lineType, key, _, err = m.processLine(bytes.NewBuffer(line)); err != nil {
+		return
+	}
+
+	if lineType == BucketPutLine || lineType == BucketDeleteLine {
+		if prefix, _, err = getBucket(line[1:]); err != nil {
+			return
+		}
+	}
+
+	k := string(prefix) + "\x00" + string(key)
+	if lineType == PutLine || lineType == BucketPutLine {
+		s.keys[k] = struct{}{}
+	} else {
+		delete(s.keys, k)
+	}
+
+	return
+}
@@ -0,0 +1,306 @@
+package mrT
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+)
+
+// File is an open handle to a stored file
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Seeker
+	io.Closer
+
+	Truncate(size int64) error
+	Sync() error
+}
+
+// Storage is the backing storage for the current file, the archive and temporary staging files
+// Note: Names are slash separated paths built from the directory MrT is opened with
+type Storage interface {
+	// MkdirAll will create a directory along with any missing parents
+	MkdirAll(dir string) error
+	// Open will open a file for reading and writing, the file is created when it does not exist
+	Open(name string) (File, error)
+	// OpenReadOnly will open an existing file for reading, writes to the file will fail
+	OpenReadOnly(name string) (File, error)
+	// TempFile will create a new temporary file used for staging, the file is removed by name once it is no longer needed
+	TempFile() (f File, name string, err error)
+	// Rename will atomically replace newName with oldName
+	Rename(oldName, newName string) error
+	// Remove will remove a file
+	Remove(name string) error
+	// Lock will acquire an exclusive lock for name, ErrLocked is returned when the lock is already held
+	// Note: The lock is held until the returned closer is closed
+	Lock(name string) (io.Closer, error)
+}
+
+// NewOSStorage will return a new operating system storage
+func NewOSStorage() *OSStorage {
+	return &OSStorage{}
+}
+
+// OSStorage stores files using the operating system
+type OSStorage struct{}
+
+// MkdirAll will create a directory along with any missing parents
+func (o *OSStorage) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, 0755)
+}
+
+// Open will open a file for reading and writing, the file is created when it does not exist
+func (o *OSStorage) Open(name string) (f File, err error) {
+	var osf *os.File
+	if osf, err = os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644); err != nil {
+		return
+	}
+
+	f = osf
+	return
+}
+
+// OpenReadOnly will open an existing file for reading, writes to the file will fail
+func (o *OSStorage) OpenReadOnly(name string) (f File, err error) {
+	var osf *os.File
+	if osf, err = os.Open(name); err != nil {
+		return
+	}
+
+	f = osf
+	return
+}
+
+// TempFile will create a new temporary file within the operating system's temporary directory
+func (o *OSStorage) TempFile() (f File, name string, err error) {
+	var osf *os.File
+	if osf, err = ioutil.TempFile("", "mrT"); err != nil {
+		return
+	}
+
+	f = osf
+	name = osf.Name()
+	return
+}
+
+// Rename will atomically replace newName with oldName
+func (o *OSStorage) Rename(oldName, newName string) (err error) {
+	if err = os.Rename(oldName, newName); err != nil {
+		return
+	}
+
+	// Sync the parent directory so the rename survives a crash
+	var dir *os.File
+	if dir, err = os.Open(path.Dir(newName)); err != nil {
+		return
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+// Remove will remove a file
+func (o *OSStorage) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// Lock will acquire an exclusive lock for name using an OS-level lock on the file, the file is created when it
+// does not exist
+// Note: The lock is released if the process exits, lock files are left in place. OS-level locks are only supported on
+// unix platforms (linux, darwin and the BSDs), elsewhere the lock file is created without being locked
+func (o *OSStorage) Lock(name string) (l io.Closer, err error) {
+	var f *os.File
+	if f, err = lockFile(name); err != nil {
+		return
+	}
+
+	l = f
+	return
+}
+
+func newLockedFile(fs Storage, name string, readOnly bool) (lf *lockedFile, err error) {
+	var l lockedFile
+	l.fs = fs
+	l.name = name
+	l.readOnly = readOnly
+	if readOnly {
+		// Read-only files are never created, they are opened as the writer creates them
+		return &l, nil
+	}
+
+	// Ensure our file exists
+	var f File
+	if f, err = fs.Open(name); err != nil {
+		return
+	}
+
+	if err = f.Close(); err != nil {
+		return
+	}
+
+	lf = &l
+	return
+}
+
+// lockedFile guards a database file, readers are shared while writers are exclusive
+// Note: Each reader and writer is given it's own handle (and position)
+type lockedFile struct {
+	mux  sync.RWMutex
+	fs   Storage
+	name string
+	// Whether or not handles are opened read-only
+	readOnly bool
+}
+
+// open will open a new handle, a failed open results in a handle which returns the open error
+func (l *lockedFile) open() (f File) {
+	var err error
+	if l.readOnly {
+		f, err = l.fs.OpenReadOnly(l.name)
+	} else {
+		f, err = l.fs.Open(l.name)
+	}
+
+	if err != nil {
+		return failedFile{err}
+	}
+
+	return f
+}
+
+// Reader will return a shared reader, the reader must be closed
+func (l *lockedFile) Reader() *fileReader {
+	l.mux.RLock()
+	return &fileReader{File: l.open(), l: l}
+}
+
+// Appender will return an exclusive writer positioned at the end of the file, the writer must be closed
+func (l *lockedFile) Appender() *fileWriter {
+	w := l.Writer()
+	if _, err := w.Seek(0, io.SeekEnd); err != nil {
+		w.File.Close()
+		w.File = failedFile{err}
+	}
+
+	return w
+}
+
+// Writer will return an exclusive writer positioned at the start of the file, the writer must be closed
+// Note: The file is synced when the writer is closed
+func (l *lockedFile) Writer() *fileWriter {
+	l.mux.Lock()
+	return &fileWriter{File: l.open(), l: l}
+}
+
+// With will call fn with an exclusive handle
+func (l *lockedFile) With(fn func(f File) error) (err error) {
+	w := l.Writer()
+	defer w.close()
+	return fn(w.File)
+}
+
+// replace will atomically replace the file with the contents written by fn
+// Note: The write lock must be held by the caller, handles opened before replace will reference the old contents
+func (l *lockedFile) replace(fn func(f File) error) (err error) {
+	tmpN := l.name + ".tmp"
+
+	var f File
+	if f, err = l.fs.Open(tmpN); err != nil {
+		return
+	}
+
+	// Clear anything left behind by a previous attempt
+	if err = f.Truncate(0); err == nil {
+		err = fn(f)
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		l.fs.Remove(tmpN)
+		return
+	}
+
+	return l.fs.Rename(tmpN, l.name)
+}
+
+// size will return the size of the file
+func (l *lockedFile) size() (size int64, err error) {
+	f := l.open()
+	defer f.Close()
+	return f.Seek(0, io.SeekEnd)
+}
+
+// Close will close the file
+func (l *lockedFile) Close() (err error) {
+	return
+}
+
+// fileReader is a shared handle to a locked file
+type fileReader struct {
+	File
+	l *lockedFile
+}
+
+// Close will close the handle and release the read lock
+func (r *fileReader) Close() (err error) {
+	if r.l == nil {
+		return
+	}
+
+	err = r.File.Close()
+	r.l.mux.RUnlock()
+	r.l = nil
+	return
+}
+
+// fileWriter is an exclusive handle to a locked file
+type fileWriter struct {
+	File
+	l *lockedFile
+}
+
+// Close will sync and close the handle and release the write lock
+func (w *fileWriter) Close() (err error) {
+	if w.l == nil {
+		return
+	}
+
+	err = w.File.Sync()
+	if cerr := w.close(); err == nil {
+		err = cerr
+	}
+
+	return
+}
+
+// close will close the handle and release the write lock without syncing
+func (w *fileWriter) close() (err error) {
+	if w.l == nil {
+		return
+	}
+
+	err = w.File.Close()
+	w.l.mux.Unlock()
+	w.l = nil
+	return
+}
+
+// failedFile is a handle to a file which could not be opened
+type failedFile struct {
+	err error
+}
+
+func (f failedFile) Read([]byte) (int, error)          { return 0, f.err }
+func (f failedFile) ReadAt([]byte, int64) (int, error) { return 0, f.err }
+func (f failedFile) Write([]byte) (int, error)         { return 0, f.err }
+func (f failedFile) Seek(int64, int) (int64, error)    { return 0, f.err }
+func (f failedFile) Close() error                      { return nil }
+func (f failedFile) Truncate(int64) error              { return f.err }
+func (f failedFile) Sync() error                       { return f.err }
@@ -0,0 +1,159 @@
+package mrT
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// ObjectStore stores archive segments which have been tiered out of the archive file
+type ObjectStore interface {
+	// Put will store an object, replacing any existing object with the same key
+	Put(key string, value []byte) error
+	// Get will retrieve an object, ErrObjectNotFound is returned when the object does not exist
+	Get(key string) (value []byte, err error)
+	// Delete will remove an object, deleting an object which does not exist is not an error
+	Delete(key string) error
+}
+
+// NewDirStore will return a new object store which stores objects as files within dir
+func NewDirStore(dir string) *DirStore {
+	var d DirStore
+	d.dir = dir
+	return &d
+}
+
+// DirStore is an object store backed by a directory
+type DirStore struct {
+	dir string
+}
+
+// Put will store an object, replacing any existing object with the same key
+// Note: Objects are written to a temporary file and moved into place so a partial object is never visible
+func (d *DirStore) Put(key string, value []byte) (err error) {
+	filename := d.getPath(key)
+	if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return
+	}
+
+	tmpN := filename + ".tmp"
+	if err = copyToFile(NewOSStorage(), tmpN, bytes.NewReader(value)); err != nil {
+		os.Remove(tmpN)
+		return
+	}
+
+	return os.Rename(tmpN, filename)
+}
+
+// Get will retrieve an object, ErrObjectNotFound is returned when the object does not exist
+func (d *DirStore) Get(key string) (value []byte, err error) {
+	if value, err = ioutil.ReadFile(d.getPath(key)); os.IsNotExist(err) {
+		err = ErrObjectNotFound
+	}
+
+	return
+}
+
+// Delete will remove an object, deleting an object which does not exist is not an error
+func (d *DirStore) Delete(key string) (err error) {
+	if err = os.Remove(d.getPath(key)); os.IsNotExist(err) {
+		err = nil
+	}
+
+	return
+}
+
+// getPath will return the file path of an object
+func (d *DirStore) getPath(key string) string {
+	// Cleaning the key as an absolute path ensures it cannot escape our directory
+	return filepath.Join(d.dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func newTier(store ObjectStore) *tier {
+	var t tier
+	t.store = store
+	return &t
+}
+
+// tier moves archive segments to and from an object store
+// Note: The most recently fetched segment is cached, segments are immutable once stored
+type tier struct {
+	store ObjectStore
+
+	mux sync.Mutex
+	// Checksum and contents of the cached segment
+	checksum string
+	segment  []byte
+}
+
+// put will store a segment, returning it's key and checksum
+// Note: Keys are derived from the segment's checksum, storing the same segment twice is harmless
+func (t *tier) put(name string, segment []byte) (key, checksum string, err error) {
+	sum := sha256.Sum256(segment)
+	checksum = hex.EncodeToString(sum[:])
+	key = path.Join(name, checksum+".segment")
+	err = t.store.Put(key, segment)
+	return
+}
+
+// get will retrieve a segment, ensuring it matches it's checksum
+func (t *tier) get(key, checksum string) (segment []byte, err error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if checksum == t.checksum {
+		return t.segment, nil
+	}
+
+	if segment, err = t.store.Get(key); err != nil {
+		return
+	}
+
+	if sum := sha256.Sum256(segment); hex.EncodeToString(sum[:]) != checksum {
+		return nil, ErrObjectChecksum
+	}
+
+	t.checksum = checksum
+	t.segment = segment
+	return
+}
+
+// tierSegment will store a compressed segment containing the provided lines and write a tiered line referencing it
+func (m *MrT) tierSegment(w io.Writer, lines []byte) (err error) {
+	var segment []byte
+	if segment, err = m.compressSegment(lines); err != nil {
+		return
+	}
+
+	var key, checksum string
+	if key, checksum, err = m.tier.put(m.name, segment); err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err = m.writeLine(&buf, TieredLine, []byte(key), []byte(checksum)); err != nil {
+		return
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return
+}
+
+// fetchSegment will fetch the segment referenced by a tiered line (without it's line type)
+func (m *MrT) fetchSegment(b []byte) (segment []byte, err error) {
+	if m.tier == nil {
+		return nil, ErrNoObjectStore
+	}
+
+	var key, checksum []byte
+	if key, checksum, err = getKV(b); err != nil {
+		return
+	}
+
+	return m.tier.get(string(key), string(checksum))
+}
@@ -2,9 +2,10 @@ package mrT
 
 import "bytes"
 
-func newTxn(buf *bytes.Buffer, fn WriteFn) (txn Txn) {
+func newTxn(buf *bytes.Buffer, fn WriteFn, bfn BucketWriteFn) (txn Txn) {
 	txn.buf = buf
 	txn.writeLine = fn
+	txn.writeBucketLine = bfn
 	return
 }
 
@@ -13,12 +14,15 @@ type Txn struct {
 	buf *bytes.Buffer
 	// write func
 	writeLine WriteFn
+	// bucket write func
+	writeBucketLine BucketWriteFn
 }
 
 func (t *Txn) clear() {
 	// Clear references
 	t.buf = nil
 	t.writeLine = nil
+	t.writeBucketLine = nil
 	// If you hold onto a transaction after the function is over, there is a special place in hell for you.
 }
 
@@ -32,5 +36,13 @@ func (t *Txn) Delete(key []byte) error {
 	return t.writeLine(t.buf, DeleteLine, key, nil)
 }
 
+// Bucket will return a writer scoped to the provided bucket
+func (t *Txn) Bucket(name string) *Bucket {
+	return newBucket(t, name)
+}
+
 // WriteFn is the function signature for calling mrT.writeLn
 type WriteFn func(buf *bytes.Buffer, lineType byte, key, value []byte) error
+
+// BucketWriteFn is the function signature for calling mrT.writeBucketLine
+type BucketWriteFn func(buf *bytes.Buffer, lineType byte, bucket, key, value []byte) error
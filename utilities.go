@@ -1,14 +1,16 @@
 package mrT
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
 	"io"
-	"io/ioutil"
-	"os"
+	"strconv"
+	"time"
 
 	"github.com/PathDNA/atoms"
 	"github.com/itsmontoya/seeker"
+	"github.com/missionMeteora/uuid"
 )
 
 // ForEachFn is used for iterating through entries
@@ -20,9 +22,15 @@ type ForEachRawFn func(line []byte) (err error)
 // ForEachTxnFn is used for iterating through transactions
 type ForEachTxnFn func(ti *TxnInfo) (err error)
 
+// KeyHistoryFn is used for iterating through the history of a key
+type KeyHistoryFn func(ti *TxnInfo, ai *ActionInfo) (err error)
+
 // TxnFn is used for transactions
 type TxnFn func(txn *Txn) error
 
+// BucketTxnFn is used for bucket scoped transactions
+type BucketTxnFn func(b *Bucket) error
+
 // TxnInfo is information about a transaction
 type TxnInfo struct {
 	// Transaction id
@@ -33,6 +41,20 @@ type TxnInfo struct {
 	Actions []*ActionInfo `json:"actions"`
 }
 
+func newTxnInfo(txnID string) (ti *TxnInfo, err error) {
+	var ts time.Time
+	if ts, err = getTxnTime(txnID); err != nil {
+		return
+	}
+
+	ti = &TxnInfo{
+		ID: txnID,
+		TS: ts.Unix(),
+	}
+
+	return
+}
+
 func newActionInfo(put bool, key, value []byte) *ActionInfo {
 	var a ActionInfo
 	a.Put = put
@@ -43,9 +65,10 @@ func newActionInfo(put bool, key, value []byte) *ActionInfo {
 
 // ActionInfo is information about an action
 type ActionInfo struct {
-	Put   bool   `json:"put"`
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Put    bool   `json:"put"`
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
 }
 
 func getFirstTxn(buf *bytes.Buffer) (err error) {
@@ -57,52 +80,86 @@ func getFirstTxn(buf *bytes.Buffer) (err error) {
 }
 
 // getKV will extract the key and value from a payload
-func getKV(b []byte) (key, value []byte) {
-	// Set index at 8 to accommodate 8 bytes for key length
-	idx := uint64(8)
-	blen := uint64(len(b))
-	if blen < idx {
+// Note: Bytes following the value are ignored
+func getKV(b []byte) (key, value []byte, err error) {
+	return parseKV(b, maxFieldSize, maxFieldSize)
+}
+
+// parseKV will extract the key and value from a payload, enforcing the provided maximum sizes
+func parseKV(b []byte, maxKey, maxValue uint64) (key, value []byte, err error) {
+	var rest []byte
+	if key, rest, err = parseField(b, 0, maxKey); err != nil {
 		return
 	}
 
-	// Get key length
-	lv := binary.LittleEndian.Uint64(b[0:idx])
-	if blen < idx+lv {
+	value, _, err = parseField(rest, int64(len(b)-len(rest)), maxValue)
+	return
+}
+
+// splitField will extract a length-prefixed field and return the remaining bytes
+func splitField(b []byte) (field, rest []byte, err error) {
+	return parseField(b, 0, maxFieldSize)
+}
+
+// parseField will extract a length-prefixed field, offset is the offset of b within it's record
+func parseField(b []byte, offset int64, max uint64) (field, rest []byte, err error) {
+	if len(b) < 8 {
+		err = newRecordError(ErrTruncatedRecord, offset)
 		return
 	}
 
-	key = b[idx : lv+idx]
-
-	// Increment index past our key bytes
-	idx += lv
-	if blen < idx {
+	flen := binary.LittleEndian.Uint64(b)
+	if flen > max {
+		err = newRecordError(ErrLengthOverflow, offset)
 		return
 	}
 
-	// Get value length
-	lv = binary.LittleEndian.Uint64(b[idx : idx+8])
-	// Increment our index past the value length
-	idx += 8
-	if blen < lv+idx {
+	if flen > uint64(len(b)-8) {
+		err = newRecordError(ErrTruncatedRecord, offset+8)
 		return
 	}
 
-	// Get upper range in case we need to pack in data after the value
-	value = b[idx : lv+idx]
+	field = b[8 : 8+flen]
+	rest = b[8+flen:]
 	return
 }
 
-// getKVSafe will extract the key and value from a payload and apply copy on read
-func getKVSafe(b []byte) (key, value []byte) {
-	key, value = getKV(b)
-	key = append([]byte{}, key...)
-	value = append([]byte{}, value...)
+// getKey will return the key of a payload, an empty key is returned for invalid payloads
+func getKey(b []byte) string {
+	kb, _, _ := getKV(b)
+	return string(kb)
+}
+
+// TxnTime will return the timestamp embedded within a transaction id
+func TxnTime(txnID string) (ts time.Time, err error) {
+	return getTxnTime(txnID)
+}
+
+// getTxnTime will return the timestamp embedded within a transaction id
+func getTxnTime(txnID string) (ts time.Time, err error) {
+	var u uuid.UUID
+	if u, err = uuid.ParseStr(txnID); err != nil {
+		return
+	}
+
+	ts = u.Time()
 	return
 }
 
-func getKey(b []byte) string {
-	kb, _ := getKV(b)
-	return string(kb)
+// getTxnSize will return the size of a transaction's data lines from the value of it's transaction line
+// Note: Transactions written before sizes were recorded are reported as not ok
+func getTxnSize(value []byte) (size int64, ok bool) {
+	if len(value) == 0 {
+		return
+	}
+
+	var err error
+	if size, err = strconv.ParseInt(string(value), 10, 64); err != nil || size < 0 {
+		return 0, false
+	}
+
+	ok = true
+	return
 }
 
 func getLineType(buf *bytes.Buffer) (lineType byte, err error) {
@@ -133,7 +190,7 @@ func (l *lbuf) Update(fn func(*bytes.Buffer) error) (err error) {
 	return
 }
 
-func seekFirstTxn(f *os.File) (err error) {
+func seekFirstTxn(f File) (err error) {
 	if _, err = f.Seek(0, io.SeekStart); err != nil {
 		return
 	}
@@ -183,7 +240,11 @@ func prevTxn(s *seeker.Seeker) (txnID string, err error) {
 
 			if lineType == TransactionLine {
 				// Transaction found!
-				tidb, _ := getKV(buf.Bytes())
+				var tidb []byte
+				if tidb, _, err = getKV(buf.Bytes()); err != nil {
+					return
+				}
+
 				txnID = string(tidb)
 				return
 			}
@@ -218,9 +279,12 @@ func nextTxn(s *seeker.Seeker) (txnID string, err error) {
 			return
 		}
 
-		tidb, _ := getKV(buf.Bytes())
-		txnID = string(tidb)
+		var tidb []byte
+		if tidb, _, err = getKV(buf.Bytes()); err != nil {
+			return
+		}
 
+		txnID = string(tidb)
 		return seeker.ErrEndEarly
 	}); err != nil {
 		return
@@ -241,46 +305,84 @@ func replayID(s *seeker.Seeker) (txnID string, err error) {
 		return
 	}
 
-	if err = s.ReadLine(func(buf *bytes.Buffer) (err error) {
-		var lineType byte
+	var lineType byte
+	fn := func(buf *bytes.Buffer) (err error) {
 		if lineType, err = buf.ReadByte(); err != nil {
 			return
 		}
 
-		if lineType != ReplayLine {
+		switch lineType {
+		case HeaderLine:
+			// Our replay line will be the following line
+		case ReplayLine:
+			var tidb []byte
+			if tidb, _, err = getKV(buf.Bytes()); err != nil {
+				return
+			}
+
+			txnID = string(tidb)
+		default:
 			return ErrNoTxn
 		}
 
-		tidb, _ := getKV(buf.Bytes())
-		txnID = string(tidb)
 		return
-	}); err != nil {
+	}
+
+	if err = s.ReadLine(fn); err != nil {
 		return
 	}
 
+	if lineType == HeaderLine {
+		if err = s.ReadLine(fn); err != nil {
+			return
+		}
+
+		if lineType != ReplayLine {
+			return "", ErrNoTxn
+		}
+	}
+
 	// Set cursor to the beginning of the transaction line
 	s.PrevLine()
 	return
 }
 
-func getTmp() (tmpF *os.File, name string, err error) {
-	if tmpF, err = ioutil.TempFile("", "mrT"); err != nil {
+// readLineAt will read the line which starts at the provided offset
+func readLineAt(r io.ReadSeeker, offset int64) (buf *bytes.Buffer, err error) {
+	if _, err = r.Seek(offset, io.SeekStart); err != nil {
 		return
 	}
 
-	name = tmpF.Name()
-	return
-}
-
-func clearFile(f *os.File) (err error) {
-	if err = f.Truncate(0); err != nil {
+	var line []byte
+	if line, err = bufio.NewReader(r).ReadBytes('\n'); err != nil {
 		return
 	}
 
-	_, err = f.Seek(0, io.SeekStart)
+	buf = bytes.NewBuffer(line[:len(line)-1])
 	return
 }
 
+// forEachLine will call fn for each complete line (without it's trailing newline) along with it's offset
+// Note: Offset is the offset of the first byte within the reader
+func forEachLine(r io.Reader, offset int64, fn func(line []byte, offset int64) error) (err error) {
+	br := bufio.NewReader(r)
+	for {
+		var line []byte
+		if line, err = br.ReadBytes('\n'); err == io.EOF {
+			// Partial lines are not yet part of a transaction, we can stop here
+			return nil
+		} else if err != nil {
+			return
+		}
+
+		lineOffset := offset
+		offset += int64(len(line))
+		if err = fn(line[:len(line)-1], lineOffset); err != nil {
+			return
+		}
+	}
+}
+
 // ReadSeekCloser incorporates reader, seeker, and closer interfaces
 type ReadSeekCloser interface {
 	io.Reader
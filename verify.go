@@ -0,0 +1,386 @@
+package mrT
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// VerifyOpts are the options used when verifying
+type VerifyOpts struct {
+	// SkipArchive will only verify the current file
+	SkipArchive bool
+	// SkipDecode will skip decoding puts and deletes through their middlewares
+	SkipDecode bool
+	// MaxProblems will stop verification once this many problems have been found, zero is unlimited
+	MaxProblems int
+}
+
+// VerifyReport is the result of a verification
+type VerifyReport struct {
+	// Number of lines verified, lines within segments are included
+	Lines int `json:"lines"`
+	// Number of transactions verified
+	Transactions int `json:"transactions"`
+	// Problems found
+	Problems []Problem `json:"problems"`
+	// Warnings are anomalies which are not corruption, such as a transaction older than the transaction preceding
+	// it (which an import of an earlier payload will produce)
+	Warnings []Problem `json:"warnings"`
+}
+
+// OK will return whether or not the verification found no problems
+// Note: Warnings are not problems
+func (v *VerifyReport) OK() bool {
+	return len(v.Problems) == 0
+}
+
+// Problem is an integrity issue found while verifying
+type Problem struct {
+	// Whether or not the problem is within the archive
+	Archived bool `json:"archived"`
+	// Offset of the line within it's file
+	Offset int64 `json:"offset"`
+	// Offset of the line within it's segment, -1 when the line is not within a segment
+	Inner int64 `json:"inner"`
+	// Description of the problem
+	Message string `json:"message"`
+}
+
+// String will return a human readable representation of the problem
+func (p Problem) String() string {
+	file := "current"
+	if p.Archived {
+		file = "archive"
+	}
+
+	if p.Inner >= 0 {
+		return fmt.Sprintf("%s file offset %d (segment offset %d): %s", file, p.Offset, p.Inner, p.Message)
+	}
+
+	return fmt.Sprintf("%s file offset %d: %s", file, p.Offset, p.Message)
+}
+
+func newVerifier(m *MrT, opts VerifyOpts) *verifier {
+	var v verifier
+	v.m = m
+	v.opts = opts
+	return &v
+}
+
+// verifier walks the archive and current file, recording any problems it finds
+type verifier struct {
+	m    *MrT
+	opts VerifyOpts
+	r    VerifyReport
+
+	// Whether or not the archive is being verified
+	archived bool
+	// Line number within the file being verified
+	lineNum int
+	// Whether or not action lines are currently allowed
+	inTxn bool
+
+	// Last transaction id and time
+	lastTxn string
+	lastTS  time.Time
+	// Last transaction id within the archive
+	archiveTxn string
+
+	// Location, recorded size and read size of the current transaction's data lines
+	txnOffset, txnInner int64
+	txnSize, txnRead    int64
+	// Whether or not the current transaction recorded it's size
+	sized bool
+}
+
+// isFull will return whether or not we have reached our maximum problems
+func (v *verifier) isFull() bool {
+	return v.opts.MaxProblems > 0 && len(v.r.Problems) >= v.opts.MaxProblems
+}
+
+func (v *verifier) addProblem(offset, inner int64, format string, args ...interface{}) {
+	if v.isFull() {
+		return
+	}
+
+	var p Problem
+	p.Archived = v.archived
+	p.Offset = offset
+	p.Inner = inner
+	p.Message = fmt.Sprintf(format, args...)
+	v.r.Problems = append(v.r.Problems, p)
+}
+
+func (v *verifier) addWarning(offset, inner int64, format string, args ...interface{}) {
+	var p Problem
+	p.Archived = v.archived
+	p.Offset = offset
+	p.Inner = inner
+	p.Message = fmt.Sprintf(format, args...)
+	v.r.Warnings = append(v.r.Warnings, p)
+}
+
+// verifyFile will verify every line within a file
+func (v *verifier) verifyFile(r io.ReadSeeker, archived bool) (err error) {
+	v.archived = archived
+	v.lineNum = 0
+	v.inTxn = false
+	v.sized = false
+
+	var size int64
+	if size, err = r.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	var next int64
+	if err = forEachLine(r, 0, func(line []byte, offset int64) (err error) {
+		next = offset + int64(len(line)) + 1
+		v.verifyLine(line, offset, -1)
+		v.lineNum++
+		return
+	}); err != nil {
+		return
+	}
+
+	v.checkTxnSize()
+	if next < size {
+		v.addProblem(next, -1, "partial line of %d bytes", size-next)
+	}
+
+	return
+}
+
+// checkTxnSize will ensure the current transaction contains all of it's recorded data lines
+func (v *verifier) checkTxnSize() {
+	if v.sized && v.txnRead < v.txnSize {
+		v.addProblem(v.txnOffset, v.txnInner, "transaction is missing %d bytes of data lines", v.txnSize-v.txnRead)
+	}
+
+	v.sized = false
+}
+
+// verifyLine will verify a single line, inner is the offset within the line's segment (or -1)
+func (v *verifier) verifyLine(line []byte, offset, inner int64) {
+	if v.isFull() {
+		return
+	}
+
+	v.r.Lines++
+	if len(line) == 0 {
+		v.addProblem(offset, inner, "empty line")
+		return
+	}
+
+	lineType, payload := line[0], line[1:]
+	switch lineType {
+	case HeaderLine:
+		v.verifyHeader(payload, offset, inner)
+
+	case TransactionLine:
+		v.verifyTxn(payload, offset, inner)
+
+	case ReplayLine:
+		v.verifyReplay(payload, offset, inner)
+
+	case CommentLine:
+		if err := checkKV(payload); err != nil {
+			v.addProblem(offset, inner, "invalid comment: %v", err)
+		}
+
+	case PutLine, DeleteLine, BucketPutLine, BucketDeleteLine:
+		v.verifyAction(line, offset, inner)
+
+	case SegmentLine, TieredLine:
+		v.verifySegment(line, offset, inner)
+
+	default:
+		v.addProblem(offset, inner, "unknown line type %d", lineType)
+	}
+}
+
+func (v *verifier) verifyHeader(payload []byte, offset, inner int64) {
+	if v.lineNum != 0 || inner >= 0 {
+		v.addProblem(offset, inner, "header is not the first line of the file")
+	}
+
+	if err := checkKV(payload); err != nil {
+		v.addProblem(offset, inner, "invalid header: %v", err)
+		return
+	}
+
+	var hdr Header
+	_, value, _ := getKV(payload)
+	if err := json.Unmarshal(value, &hdr); err != nil {
+		v.addProblem(offset, inner, "invalid header: %v", err)
+		return
+	}
+
+	if err := v.m.hdr.validate(&hdr); err != nil {
+		v.addProblem(offset, inner, "%v", err)
+	}
+}
+
+func (v *verifier) verifyTxn(payload []byte, offset, inner int64) {
+	v.r.Transactions++
+	v.inTxn = true
+	v.checkTxnSize()
+	if err := checkKV(payload); err != nil {
+		v.addProblem(offset, inner, "invalid transaction: %v", err)
+		return
+	}
+
+	key, value, _ := getKV(payload)
+	txnID := string(key)
+	if len(value) > 0 {
+		if v.txnSize, v.sized = getTxnSize(value); !v.sized {
+			v.addProblem(offset, inner, "invalid transaction size %q", value)
+		}
+
+		v.txnOffset, v.txnInner, v.txnRead = offset, inner, 0
+	}
+
+	ts, err := getTxnTime(txnID)
+	if err != nil {
+		v.addProblem(offset, inner, "invalid transaction id %q: %v", txnID, err)
+		return
+	}
+
+	switch {
+	case txnID == v.lastTxn:
+		v.addProblem(offset, inner, "duplicate transaction %s", txnID)
+	case ts.Before(v.lastTS):
+		// Imports accept payloads which begin before our last transaction, this is not corruption
+		v.addWarning(offset, inner, "transaction %s is older than the transaction preceding it", txnID)
+	}
+
+	v.lastTxn = txnID
+	v.lastTS = ts
+	if v.archived {
+		v.archiveTxn = v.lastTxn
+	}
+}
+
+func (v *verifier) verifyReplay(payload []byte, offset, inner int64) {
+	v.inTxn = true
+	v.checkTxnSize()
+	if v.archived {
+		v.addProblem(offset, inner, "replay line within the archive")
+	}
+
+	if err := checkKV(payload); err != nil {
+		v.addProblem(offset, inner, "invalid replay: %v", err)
+		return
+	}
+
+	replayID := getKey(payload)
+	if !v.opts.SkipArchive && replayID != v.archiveTxn {
+		// Replays are written as part of an archive, they should reference the last archived transaction
+		v.addProblem(offset, inner, "replay %s does not match the last archived transaction %s", replayID, v.archiveTxn)
+	}
+}
+
+func (v *verifier) verifyAction(line []byte, offset, inner int64) {
+	v.txnRead += int64(len(line)) + 1
+	if !v.inTxn {
+		v.addProblem(offset, inner, "%s outside of a transaction", getLineTypeName(line[0]))
+	}
+
+	payload := line[1:]
+	if line[0] == BucketPutLine || line[0] == BucketDeleteLine {
+		var (
+			bucket []byte
+			err    error
+		)
+
+		if bucket, payload, err = getBucket(payload); err != nil {
+			v.addProblem(offset, inner, "invalid bucket: %v", err)
+			return
+		} else if len(bucket) == 0 {
+			v.addProblem(offset, inner, "invalid bucket name")
+			return
+		}
+	}
+
+	if !v.m.isMWWrite(line[0]) {
+		if err := checkKV(payload); err != nil {
+			v.addProblem(offset, inner, "invalid %s: %v", getLineTypeName(line[0]), err)
+			return
+		}
+	}
+
+	if v.opts.SkipDecode {
+		return
+	}
+
+	if _, _, _, err := v.m.processLine(bytes.NewBuffer(line)); err != nil {
+		v.addProblem(offset, inner, "cannot decode %s: %v", getLineTypeName(line[0]), err)
+	}
+}
+
+func (v *verifier) verifySegment(line []byte, offset, inner int64) {
+	if !v.archived || inner >= 0 {
+		v.addProblem(offset, inner, "segment outside of the archive")
+		return
+	}
+
+	if line[0] == TieredLine {
+		if err := checkKV(line[1:]); err != nil {
+			v.addProblem(offset, inner, "invalid tiered segment: %v", err)
+			return
+		}
+	}
+
+	lines, err := v.m.readSegmentLine(line)
+	if err != nil {
+		v.addProblem(offset, inner, "cannot read segment: %v", err)
+		return
+	}
+
+	var next int64
+	forEachLine(bytes.NewReader(lines), 0, func(line []byte, lineOffset int64) error {
+		next = lineOffset + int64(len(line)) + 1
+		v.verifyLine(line, offset, lineOffset)
+		return nil
+	})
+
+	if next < int64(len(lines)) {
+		v.addProblem(offset, next, "partial line within segment")
+	}
+}
+
+// checkKV will ensure a payload contains exactly a length prefixed key and value
+func checkKV(b []byte) (err error) {
+	var key, value []byte
+	if key, value, err = getKV(b); err != nil {
+		return
+	}
+
+	if trailing := len(b) - len(key) - len(value) - 16; trailing > 0 {
+		return fmt.Errorf("%d unexpected trailing bytes", trailing)
+	}
+
+	return
+}
+
+// getLineTypeName will return the name of a line type
+func getLineTypeName(lineType byte) string {
+	switch lineType {
+	case PutLine:
+		return "put"
+	case DeleteLine:
+		return "delete"
+	case BucketPutLine:
+		return "bucket put"
+	case BucketDeleteLine:
+		return "bucket delete"
+	default:
+		return fmt.Sprintf("line type %d", lineType)
+	}
+}